@@ -0,0 +1,72 @@
+package sess
+
+import (
+	"context"
+	xerr "github.com/goclub/error"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type HubOptionAuthorization struct {
+	// 续期或重新签发 sessionID 时写入的响应头，默认为 X-Session-Id
+	ResponseHeaderKey string
+}
+
+// AuthorizationReadWriter 从 Authorization: Bearer <sessionID> 请求头读取 sessionID
+// 新的 sessionID 写入 HubOption{}.Authorization.ResponseHeaderKey 响应头，由客户端替换之后请求的 Authorization
+// 适用于 API 网关和 OpenAPI 等默认使用 bearer 认证的场景
+type AuthorizationReadWriter struct {
+	Writer http.ResponseWriter
+	// 与 HeaderReadWriter 一致，使用 Header 而不是 *http.Request
+	Header http.Header
+}
+
+// AuthorizationSchemeError 表示 Authorization 请求头不是 Bearer 认证，可以通过 sess.AsAuthorizationSchemeError(err) 判断
+// hub.Middleware() 未设置 OnError 时响应 401
+type AuthorizationSchemeError struct {
+	Scheme string
+}
+
+func (e *AuthorizationSchemeError) Error() string {
+	return "goclub/session: Authorization scheme must be Bearer, got " + strconv.Quote(e.Scheme)
+}
+func AsAuthorizationSchemeError(err error) (schemeErr *AuthorizationSchemeError, asSchemeError bool) {
+	asSchemeError = xerr.As(err, &schemeErr)
+	return
+}
+
+const bearerScheme = "Bearer"
+
+func (rw AuthorizationReadWriter) Read(ctx context.Context, hubOption HubOption) (sessionID string, has bool, err error) {
+	authorization := strings.TrimSpace(rw.Header.Get("Authorization"))
+	if authorization == "" {
+		return "", false, nil
+	}
+	scheme := authorization
+	token := ""
+	if index := strings.IndexByte(authorization, ' '); index != -1 {
+		scheme = authorization[:index]
+		token = strings.TrimSpace(authorization[index+1:])
+	}
+	// scheme 不区分大小写 (RFC 7235)
+	if strings.EqualFold(scheme, bearerScheme) == false {
+		return "", false, xerr.WithStack(&AuthorizationSchemeError{Scheme: scheme})
+	}
+	if token == "" {
+		return "", false, nil
+	}
+	return token, true, nil
+}
+func (rw AuthorizationReadWriter) Write(ctx context.Context, hubOption HubOption, sessionID string) (err error) {
+	if len(hubOption.Authorization.ResponseHeaderKey) == 0 {
+		return xerr.New("goclub/session: you forget set HubOption{}.Authorization.ResponseHeaderKey")
+	}
+	rw.Writer.Header().Set(hubOption.Authorization.ResponseHeaderKey, sessionID)
+	return
+}
+
+// Destroy 客户端需要自行删除保存的 sessionID
+func (rw AuthorizationReadWriter) Destroy(ctx context.Context, hubOption HubOption) (err error) {
+	return
+}
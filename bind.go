@@ -0,0 +1,246 @@
+package sess
+
+import (
+	"context"
+	xerr "github.com/goclub/error"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// BindError Session{}.Load() 和 Session{}.Save() 的字段错误，包含所有出错的字段
+// 可以通过 sess.AsBindError(err) 判断
+type BindError struct {
+	// store 中存在但 struct 中没有对应字段的 field，只在开启 HubOption{}.StrictLoad 时出现
+	// struct 中有 sess:",remain" 字段或 Store 未实现 BulkStore 时不会出现
+	UnknownFields []string
+	// 编码或解码失败的字段
+	FieldErrors []BindFieldError
+}
+type BindFieldError struct {
+	// struct 字段名
+	StructField string
+	// session 中的 field
+	Field string
+	Err   error
+}
+
+func (e *BindError) Error() string {
+	var messages []string
+	if len(e.UnknownFields) != 0 {
+		messages = append(messages, "unknown fields "+strings.Join(e.UnknownFields, ", "))
+	}
+	for _, fieldErr := range e.FieldErrors {
+		messages = append(messages, fieldErr.StructField+"("+strconv.Quote(fieldErr.Field)+"): "+fieldErr.Err.Error())
+	}
+	return "goclub/session: bind fail: " + strings.Join(messages, "; ")
+}
+func AsBindError(err error) (bindErr *BindError, asBindError bool) {
+	asBindError = xerr.As(err, &bindErr)
+	return
+}
+
+// Load 一次性读取 session 并赋值给 dst 中有 sess tag 的字段，例如:
+//
+//	type Login struct {
+//		UserID string `sess:"user_id"`
+//		Age    int    `sess:"age"`
+//		Extra  map[string]string `sess:",remain"`
+//	}
+//
+// string 类型的字段保存原始值，其他类型使用 HubOption{}.Codec 解码
+// session 中不存在的字段保持 dst 原值，sess:",remain" 字段接收 struct 中没有对应字段的 field
+// struct 中没有对应字段的 field 默认忽略，开启 HubOption{}.StrictLoad 时作为未知字段返回
+// 类型不匹配和未知字段通过 *sess.BindError 返回，此时其他字段仍会被赋值
+// Store 实现了 BulkStore 时只访问一次 store
+func (s Session) Load(ctx context.Context, dst interface{}) (err error) {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return xerr.New("goclub/session: Session{}.Load(ctx, dst) dst must be a non-nil pointer to struct")
+	}
+	fields, remain, err := parseBindFields(rv.Elem().Type())
+	if err != nil {
+		return
+	}
+	_, bulk := s.hub.store.(BulkStore)
+	var values map[string]string
+	if bulk {
+		values, err = s.getAll(ctx)
+		if err != nil {
+			return
+		}
+	} else {
+		values = map[string]string{}
+		for _, field := range fields {
+			value, hasValue, err := s.Get(ctx, field.name)
+			if err != nil {
+				return err
+			}
+			if hasValue {
+				values[field.name] = value
+			}
+		}
+	}
+	bindErr := &BindError{}
+	elem := rv.Elem()
+	known := map[string]bool{}
+	for _, field := range fields {
+		known[field.name] = true
+		value, hasValue := values[field.name]
+		if hasValue == false {
+			continue
+		}
+		fieldValue := elem.FieldByIndex(field.index)
+		if fieldValue.Kind() == reflect.String {
+			fieldValue.SetString(value)
+			continue
+		}
+		// 先解码到新值，失败时不修改 dst
+		ptr := reflect.New(fieldValue.Type())
+		decodeErr := s.hub.option.Codec.Decode(value, ptr.Interface())
+		if decodeErr != nil {
+			bindErr.FieldErrors = append(bindErr.FieldErrors, BindFieldError{
+				StructField: field.structField,
+				Field:       field.name,
+				Err:         decodeErr,
+			})
+			continue
+		}
+		fieldValue.Set(ptr.Elem())
+	}
+	extra := map[string]string{}
+	for _, field := range sortedFields(values) {
+		if known[field] || strings.HasPrefix(field, internalFieldPrefix) {
+			continue
+		}
+		extra[field] = values[field]
+		if remain == nil && s.hub.option.StrictLoad {
+			bindErr.UnknownFields = append(bindErr.UnknownFields, field)
+		}
+	}
+	if remain != nil {
+		elem.FieldByIndex(remain).Set(reflect.ValueOf(extra))
+	}
+	if len(bindErr.UnknownFields) != 0 || len(bindErr.FieldErrors) != 0 {
+		return xerr.WithStack(bindErr)
+	}
+	return
+}
+
+// Save 将 src 中有 sess tag 的字段一次性写入 session，tag 规则与 Load() 一致
+// sess:"name,omitempty" 的字段为零值时删除 session 中的 field
+// Store 实现了 BulkStore 时是原子操作，否则会逐个调用 Set 和 Delete
+// 编码失败时通过 *sess.BindError 返回且不会写入任何字段
+func (s Session) Save(ctx context.Context, src interface{}) (err error) {
+	rv := reflect.ValueOf(src)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() == false {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return xerr.New("goclub/session: Session{}.Save(ctx, src) src must be a struct or a non-nil pointer to struct")
+	}
+	fields, remain, err := parseBindFields(rv.Type())
+	if err != nil {
+		return
+	}
+	setValues := map[string]string{}
+	var deleteFields []string
+	bindErr := &BindError{}
+	for _, field := range fields {
+		fieldValue := rv.FieldByIndex(field.index)
+		if field.omitempty && fieldValue.IsZero() {
+			deleteFields = append(deleteFields, field.name)
+			continue
+		}
+		if fieldValue.Kind() == reflect.String {
+			setValues[field.name] = fieldValue.String()
+			continue
+		}
+		data, encodeErr := s.hub.option.Codec.Encode(fieldValue.Interface())
+		if encodeErr != nil {
+			bindErr.FieldErrors = append(bindErr.FieldErrors, BindFieldError{
+				StructField: field.structField,
+				Field:       field.name,
+				Err:         encodeErr,
+			})
+			continue
+		}
+		setValues[field.name] = data
+	}
+	if len(bindErr.FieldErrors) != 0 {
+		return xerr.WithStack(bindErr)
+	}
+	if remain != nil {
+		iter := rv.FieldByIndex(remain).MapRange()
+		for iter.Next() {
+			field := iter.Key().String()
+			if _, has := setValues[field]; has {
+				continue
+			}
+			setValues[field] = iter.Value().String()
+		}
+	}
+	return s.bulkWrite(ctx, setValues, deleteFields)
+}
+
+type bindField struct {
+	index       []int
+	structField string
+	name        string
+	omitempty   bool
+}
+
+// parseBindFields 解析 sess tag，没有 sess tag 或 tag 为 "-" 的字段会被忽略
+func parseBindFields(structType reflect.Type) (fields []bindField, remain []int, err error) {
+	names := map[string]string{}
+	for i := 0; i < structType.NumField(); i++ {
+		structField := structType.Field(i)
+		tag, has := structField.Tag.Lookup("sess")
+		if has == false || tag == "-" {
+			continue
+		}
+		if structField.PkgPath != "" {
+			return nil, nil, xerr.New("goclub/session: " + structType.String() + "." + structField.Name + " has sess tag but is unexported")
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		field := bindField{
+			index:       structField.Index,
+			structField: structField.Name,
+			name:        name,
+		}
+		isRemain := false
+		for _, option := range parts[1:] {
+			switch option {
+			case "omitempty":
+				field.omitempty = true
+			case "remain":
+				isRemain = true
+			default:
+				return nil, nil, xerr.New("goclub/session: " + structType.String() + "." + structField.Name + " unknown sess tag option " + strconv.Quote(option))
+			}
+		}
+		if isRemain {
+			if structField.Type != reflect.TypeOf(map[string]string{}) {
+				return nil, nil, xerr.New("goclub/session: " + structType.String() + "." + structField.Name + ` sess:",remain" must be map[string]string`)
+			}
+			if remain != nil {
+				return nil, nil, xerr.New("goclub/session: " + structType.String() + ` can only have one sess:",remain" field`)
+			}
+			remain = structField.Index
+			continue
+		}
+		if name == "" {
+			return nil, nil, xerr.New("goclub/session: " + structType.String() + "." + structField.Name + " sess tag name can not be empty")
+		}
+		if strings.HasPrefix(name, internalFieldPrefix) {
+			return nil, nil, xerr.New("goclub/session: " + structType.String() + "." + structField.Name + " sess tag name can not start with " + internalFieldPrefix)
+		}
+		if exist, has := names[name]; has {
+			return nil, nil, xerr.New("goclub/session: " + structType.String() + "." + structField.Name + " and " + exist + " have the same sess tag " + strconv.Quote(name))
+		}
+		names[name] = structField.Name
+		fields = append(fields, field)
+	}
+	return
+}
@@ -0,0 +1,83 @@
+package sess
+
+import (
+	"context"
+)
+
+// ChainReadWriter 按顺序尝试多个 SessionHttpReadWriter 读取 sessionID，并记住是哪一个提供了 sessionID
+// 续期或重新签发的 sessionID 只会通过提供 sessionID 的 ReadWriter 写回客户端
+// 适用于同一个接口同时服务浏览器(cookie)和 app(header) 的场景，例如:
+//
+//	sess.NewChainReadWriter(
+//		sess.HeaderReadWriter{Writer: writer, Header: request.Header},
+//		sess.CookieReadWriter{Writer: writer, Request: request},
+//	)
+//
+// AuthorizationReadWriter 遇到非 Bearer 的 Authorization 请求头时视为没有 sessionID，不会中断后续的 ReadWriter
+// ChainReadWriter 记录了请求的状态，每个请求都需要创建新的 ChainReadWriter
+type ChainReadWriter struct {
+	readWriters []SessionHttpReadWriter
+	// 提供 sessionID 的 ReadWriter 的下标，-1 表示没有
+	source int
+}
+
+func NewChainReadWriter(readWriters ...SessionHttpReadWriter) *ChainReadWriter {
+	return &ChainReadWriter{
+		readWriters: readWriters,
+		source:      -1,
+	}
+}
+
+// Source 返回提供 sessionID 的 ReadWriter，所有 ReadWriter 都没有 sessionID 时 has = false
+func (rw *ChainReadWriter) Source() (readWriter SessionHttpReadWriter, index int, has bool) {
+	if rw.source < 0 {
+		return nil, -1, false
+	}
+	return rw.readWriters[rw.source], rw.source, true
+}
+func (rw *ChainReadWriter) Read(ctx context.Context, hubOption HubOption) (sessionID string, has bool, err error) {
+	rw.source = -1
+	for i, readWriter := range rw.readWriters {
+		sessionID, has, err = readWriter.Read(ctx, hubOption)
+		// Authorization 请求头使用其他认证方式(例如 Basic)时视为没有 sessionID，继续尝试下一个 ReadWriter
+		if _, asSchemeError := AsAuthorizationSchemeError(err); asSchemeError {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if has {
+			rw.source = i
+			return sessionID, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Write 通过提供 sessionID 的 ReadWriter 写入，客户端没有 sessionID 时通过所有 ReadWriter 写入，由客户端选择使用哪一个
+func (rw *ChainReadWriter) Write(ctx context.Context, hubOption HubOption, sessionID string) (err error) {
+	if rw.source >= 0 {
+		return rw.readWriters[rw.source].Write(ctx, hubOption, sessionID)
+	}
+	for _, readWriter := range rw.readWriters {
+		err = readWriter.Write(ctx, hubOption, sessionID)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Destroy 通过提供 sessionID 的 ReadWriter 删除，客户端没有 sessionID 时通过所有 ReadWriter 删除
+func (rw *ChainReadWriter) Destroy(ctx context.Context, hubOption HubOption) (err error) {
+	if rw.source >= 0 {
+		return rw.readWriters[rw.source].Destroy(ctx, hubOption)
+	}
+	for _, readWriter := range rw.readWriters {
+		err = readWriter.Destroy(ctx, hubOption)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,228 @@
+package sess
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	xerr "github.com/goclub/error"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// Codec 将值编码为 store 中保存的字符串，通过 HubOption{}.Codec 配置，多个服务共享 session 时应当使用相同的 Codec
+// session.SetValue() session.GetValue() 以及 SetInt GetInt 等类型辅助方法使用 Codec 编码解码
+type Codec interface {
+	Encode(value interface{}) (data string, err error)
+	// ptr 必须是指针
+	Decode(data string, ptr interface{}) (err error)
+}
+
+// DecodeError 表示 session 中的值无法解码为目标类型，可以通过 sess.AsDecodeError(err) 判断
+type DecodeError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return "goclub/session: decode field " + strconv.Quote(e.Field) + " fail: " + e.Err.Error()
+}
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+func AsDecodeError(err error) (decodeErr *DecodeError, asDecodeError bool) {
+	asDecodeError = xerr.As(err, &decodeErr)
+	return
+}
+
+// JSONCodec 使用 encoding/json 编码，HubOption{}.Codec 的默认值
+// 可读性好，便于其他语言的服务读取
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(value interface{}) (data string, err error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", xerr.WithStack(err)
+	}
+	return string(b), nil
+}
+func (JSONCodec) Decode(data string, ptr interface{}) (err error) {
+	return json.Unmarshal([]byte(data), ptr)
+}
+
+// GobCodec 使用 encoding/gob 编码，结果使用 base64 编码以便保存在任意 Store 中
+// 只适用于所有服务都是 go 的场景
+type GobCodec struct{}
+
+func (GobCodec) Encode(value interface{}) (data string, err error) {
+	var buf bytes.Buffer
+	err = gob.NewEncoder(&buf).Encode(value)
+	if err != nil {
+		return "", xerr.WithStack(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+func (GobCodec) Decode(data string, ptr interface{}) (err error) {
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return
+	}
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(ptr)
+}
+
+// BinaryCodec 紧凑的二进制编码，格式为 1 字节类型标记 + 数据，结果使用 base64 编码以便保存在任意 Store 中
+// 支持 bool string []byte 整数 浮点数 time.Time 和实现了 encoding.BinaryMarshaler 的类型
+// 解码时类型标记与目标类型不一致会返回错误
+type BinaryCodec struct{}
+
+const (
+	binaryCodecBool   byte = 'b'
+	binaryCodecInt    byte = 'i'
+	binaryCodecUint   byte = 'u'
+	binaryCodecFloat  byte = 'f'
+	binaryCodecString byte = 's'
+	binaryCodecBytes  byte = 'y'
+	binaryCodecBinary byte = 'm'
+)
+
+var binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+var binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+
+func (BinaryCodec) Encode(value interface{}) (data string, err error) {
+	var b []byte
+	if marshaler, ok := value.(encoding.BinaryMarshaler); ok {
+		payload, err := marshaler.MarshalBinary()
+		if err != nil {
+			return "", xerr.WithStack(err)
+		}
+		b = append([]byte{binaryCodecBinary}, payload...)
+		return base64.RawStdEncoding.EncodeToString(b), nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Bool:
+		b = []byte{binaryCodecBool, 0}
+		if rv.Bool() {
+			b[1] = 1
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b = make([]byte, 1+binary.MaxVarintLen64)
+		b[0] = binaryCodecInt
+		b = b[:1+binary.PutVarint(b[1:], rv.Int())]
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		b = make([]byte, 1+binary.MaxVarintLen64)
+		b[0] = binaryCodecUint
+		b = b[:1+binary.PutUvarint(b[1:], rv.Uint())]
+	case reflect.Float32, reflect.Float64:
+		b = make([]byte, 9)
+		b[0] = binaryCodecFloat
+		binary.BigEndian.PutUint64(b[1:], math.Float64bits(rv.Float()))
+	case reflect.String:
+		b = append([]byte{binaryCodecString}, rv.String()...)
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() != reflect.Uint8 {
+			return "", xerr.New("goclub/session: BinaryCodec unsupported type " + fmt.Sprintf("%T", value))
+		}
+		b = append([]byte{binaryCodecBytes}, rv.Bytes()...)
+	default:
+		return "", xerr.New("goclub/session: BinaryCodec unsupported type " + fmt.Sprintf("%T", value))
+	}
+	return base64.RawStdEncoding.EncodeToString(b), nil
+}
+func (BinaryCodec) Decode(data string, ptr interface{}) (err error) {
+	b, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil {
+		return
+	}
+	if len(b) == 0 {
+		return xerr.New("goclub/session: BinaryCodec data is empty")
+	}
+	tag, payload := b[0], b[1:]
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return xerr.New("goclub/session: BinaryCodec Decode(data, ptr) ptr must be a non-nil pointer")
+	}
+	if rv.Type().Implements(binaryUnmarshalerType) {
+		err = binaryCodecCheckTag(tag, binaryCodecBinary, rv)
+		if err != nil {
+			return
+		}
+		return ptr.(encoding.BinaryUnmarshaler).UnmarshalBinary(payload)
+	}
+	elem := rv.Elem()
+	switch elem.Kind() {
+	case reflect.Bool:
+		err = binaryCodecCheckTag(tag, binaryCodecBool, rv)
+		if err != nil {
+			return
+		}
+		if len(payload) != 1 {
+			return xerr.New("goclub/session: BinaryCodec invalid bool")
+		}
+		elem.SetBool(payload[0] == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		err = binaryCodecCheckTag(tag, binaryCodecInt, rv)
+		if err != nil {
+			return
+		}
+		n, size := binary.Varint(payload)
+		if size <= 0 || size != len(payload) {
+			return xerr.New("goclub/session: BinaryCodec invalid int")
+		}
+		if elem.OverflowInt(n) {
+			return xerr.New("goclub/session: BinaryCodec " + strconv.FormatInt(n, 10) + " overflows " + elem.Type().String())
+		}
+		elem.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		err = binaryCodecCheckTag(tag, binaryCodecUint, rv)
+		if err != nil {
+			return
+		}
+		n, size := binary.Uvarint(payload)
+		if size <= 0 || size != len(payload) {
+			return xerr.New("goclub/session: BinaryCodec invalid uint")
+		}
+		if elem.OverflowUint(n) {
+			return xerr.New("goclub/session: BinaryCodec " + strconv.FormatUint(n, 10) + " overflows " + elem.Type().String())
+		}
+		elem.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		err = binaryCodecCheckTag(tag, binaryCodecFloat, rv)
+		if err != nil {
+			return
+		}
+		if len(payload) != 8 {
+			return xerr.New("goclub/session: BinaryCodec invalid float")
+		}
+		elem.SetFloat(math.Float64frombits(binary.BigEndian.Uint64(payload)))
+	case reflect.String:
+		err = binaryCodecCheckTag(tag, binaryCodecString, rv)
+		if err != nil {
+			return
+		}
+		elem.SetString(string(payload))
+	case reflect.Slice:
+		if elem.Type().Elem().Kind() != reflect.Uint8 {
+			return xerr.New("goclub/session: BinaryCodec unsupported type " + elem.Type().String())
+		}
+		err = binaryCodecCheckTag(tag, binaryCodecBytes, rv)
+		if err != nil {
+			return
+		}
+		elem.SetBytes(append([]byte{}, payload...))
+	default:
+		return xerr.New("goclub/session: BinaryCodec unsupported type " + elem.Type().String())
+	}
+	return
+}
+func binaryCodecCheckTag(tag byte, expected byte, rv reflect.Value) error {
+	if tag != expected {
+		return xerr.New("goclub/session: BinaryCodec can not decode " + strconv.QuoteRune(rune(tag)) + " into " + rv.Type().Elem().String())
+	}
+	return nil
+}
@@ -22,6 +22,19 @@ func newCookieFromOption(value string, option HubOptionCookie) *http.Cookie {
 		MaxAge:   option.MaxAge,
 		Expires:  expires,
 		Secure:   option.Secure,
-		HttpOnly: true,
+		HttpOnly: option.DisableHttpOnly == false,
+		SameSite: option.SameSite,
 	}
 }
+
+// setCookie 与 http.SetCookie 一致，开启 Partitioned 时添加 Partitioned 属性
+func setCookie(writer http.ResponseWriter, cookie *http.Cookie, option HubOptionCookie) {
+	value := cookie.String()
+	if value == "" {
+		return
+	}
+	if option.Partitioned {
+		value += "; Partitioned"
+	}
+	writer.Header().Add("Set-Cookie", value)
+}
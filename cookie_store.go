@@ -0,0 +1,531 @@
+package sess
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	xerr "github.com/goclub/error"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StoreProvider 由 SessionHttpReadWriter 实现，提供当前请求使用的 Store
+// Hub 获取 session 时优先使用 RequestStore()，而不是 NewHub(store, option) 传入的 store
+type StoreProvider interface {
+	RequestStore() Store
+}
+
+// withRequestStore 当 rw 实现了 StoreProvider 时返回使用请求级 Store 的 Hub 副本
+func (hub Hub) withRequestStore(rw SessionHttpReadWriter) Hub {
+	if provider, ok := rw.(StoreProvider); ok {
+		hub.store = provider.RequestStore()
+	}
+	return hub
+}
+
+// NewCookieStore 创建客户端存储，session 中的所有数据加密后保存在 cookie 中，不需要服务端存储
+// 必须与 cookieStore.ReadWriter(writer, request) 一起使用，例如:
+//
+//	hub, err := sess.NewHub(cookieStore, option)
+//	session, err := hub.GetSessionByReadWriter(ctx, cookieStore.ReadWriter(writer, request))
+//
+// 或者设置 HubOption{}.Middleware.ReadWriter = cookieStore.ReadWriter
+// 数据通过 AES-256-GCM 加密和认证，超过 ChunkSize 时拆分为多个 cookie
+// 注意:
+// 1. 修改 session 会立即修改响应的 set-cookie，所以必须在写入响应 body 之前修改 session
+// 2. 客户端可以重放旧的 cookie，Destroy 只能删除当前客户端的 cookie，不能让已泄露的 cookie 失效
+// 3. 不支持 HubOption{}.RequestCache 和 hub.GetSessionBySessionID()
+func NewCookieStore(option CookieStoreOption) (store *CookieStore, err error) {
+	if len(option.Key) != 32 {
+		return nil, xerr.New("goclub/session: NewCookieStore(option) option.Key length must be 32")
+	}
+	if option.ChunkSize == 0 {
+		option.ChunkSize = 4000
+	}
+	if option.MaxChunks == 0 {
+		option.MaxChunks = 4
+	}
+	aead, err := newAESGCM(option.Key)
+	if err != nil {
+		return nil, xerr.WithStack(err)
+	}
+	return &CookieStore{
+		option: option,
+		aead:   aead,
+	}, nil
+}
+
+type CookieStoreOption struct {
+	// (必填) 加密 session 数据的秘钥，长度为 32
+	Key []byte
+	// 单个 cookie value 的最大长度，默认 4000（浏览器限制单个 cookie 约 4096 字节，包含名称和属性）
+	ChunkSize int
+	// 最多拆分为几个 cookie，默认 4，超过时修改 session 会返回 sess.ErrCookieStoreTooLarge
+	MaxChunks int
+}
+
+// ErrCookieStoreTooLarge 表示 session 数据超过了 CookieStoreOption{}.ChunkSize * CookieStoreOption{}.MaxChunks
+var ErrCookieStoreTooLarge = xerr.New("goclub/session: CookieStore session data is too large")
+
+var errCookieStoreWithoutReadWriter = xerr.New("goclub/session: CookieStore must be used with cookieStore.ReadWriter(writer, request)")
+
+type CookieStore struct {
+	option CookieStoreOption
+	aead   cipher.AEAD
+}
+
+// ReadWriter 创建当前请求使用的 SessionHttpReadWriter，cookie 的名称和属性使用 HubOption{}.Cookie
+// 多个 cookie 的名称为 name name.1 name.2 ...
+func (m *CookieStore) ReadWriter(writer http.ResponseWriter, request *http.Request) SessionHttpReadWriter {
+	return &cookieStoreReadWriter{
+		request: request,
+		jar: &cookieJar{
+			store:  m,
+			writer: writer,
+		},
+	}
+}
+
+// CookieStore 本身不保存数据，直接调用时返回错误
+func (m *CookieStore) InitSession(ctx context.Context, storeKey string, sessionTTL time.Duration) (err error) {
+	return errCookieStoreWithoutReadWriter
+}
+func (m *CookieStore) StoreKeyExists(ctx context.Context, storeKey string) (existed bool, err error) {
+	return false, errCookieStoreWithoutReadWriter
+}
+func (m *CookieStore) StoreKeyRemainingTTL(ctx context.Context, storeKey string) (remainingTTL time.Duration, err error) {
+	return 0, errCookieStoreWithoutReadWriter
+}
+func (m *CookieStore) RenewTTL(ctx context.Context, storeKey string, ttl time.Duration) (err error) {
+	return errCookieStoreWithoutReadWriter
+}
+func (m *CookieStore) Get(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error) {
+	return "", false, errCookieStoreWithoutReadWriter
+}
+func (m *CookieStore) Set(ctx context.Context, storeKey string, field string, value string) (err error) {
+	return errCookieStoreWithoutReadWriter
+}
+func (m *CookieStore) Delete(ctx context.Context, storeKey string, field string) (err error) {
+	return errCookieStoreWithoutReadWriter
+}
+func (m *CookieStore) Destroy(ctx context.Context, storeKey string) (err error) {
+	return errCookieStoreWithoutReadWriter
+}
+
+// cookieStorePayload 加密前的 cookie 数据
+type cookieStorePayload struct {
+	StoreKey string `json:"k"`
+	// unix 毫秒，0 表示永不过期
+	ExpireAt int64             `json:"e"`
+	Values   map[string]string `json:"v"`
+}
+
+func (m *CookieStore) encode(payload cookieStorePayload, cookieName string) (data string, err error) {
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return "", xerr.WithStack(err)
+	}
+	nonce := make([]byte, m.aead.NonceSize(), m.aead.NonceSize()+len(plaintext)+m.aead.Overhead())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", xerr.WithStack(err)
+	}
+	// cookie 名称作为附加数据，避免数据被复制到其他 cookie 中使用
+	sealed := m.aead.Seal(nonce, nonce, plaintext, []byte(cookieName))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+func (m *CookieStore) decode(data string, cookieName string) (payload cookieStorePayload, ok bool) {
+	sealed, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil || len(sealed) < m.aead.NonceSize() {
+		return cookieStorePayload{}, false
+	}
+	nonce, ciphertext := sealed[:m.aead.NonceSize()], sealed[m.aead.NonceSize():]
+	plaintext, err := m.aead.Open(nil, nonce, ciphertext, []byte(cookieName))
+	if err != nil {
+		return cookieStorePayload{}, false
+	}
+	err = json.Unmarshal(plaintext, &payload)
+	if err != nil {
+		return cookieStorePayload{}, false
+	}
+	return payload, true
+}
+func cookieChunkName(name string, index int) string {
+	if index == 0 {
+		return name
+	}
+	return name + "." + strconv.Itoa(index)
+}
+
+type cookieStoreReadWriter struct {
+	request *http.Request
+	jar     *cookieJar
+}
+
+func (rw *cookieStoreReadWriter) RequestStore() Store {
+	return rw.jar
+}
+func (rw *cookieStoreReadWriter) Read(ctx context.Context, hubOption HubOption) (sessionID string, has bool, err error) {
+	name := hubOption.Cookie.Name
+	if len(name) == 0 {
+		return "", false, xerr.New("goclub/session: you forget set HubOption{}.Cookie.Name")
+	}
+	var data strings.Builder
+	chunks := 0
+	for {
+		cookie, err := rw.request.Cookie(cookieChunkName(name, chunks))
+		if err != nil {
+			break
+		}
+		data.WriteString(cookie.Value)
+		chunks++
+	}
+	rw.jar.load(hubOption, chunks)
+	if chunks == 0 {
+		return "", false, nil
+	}
+	// 无法解密或已过期的 cookie 视为没有 session
+	payload, ok := rw.jar.store.decode(data.String(), name)
+	if ok == false {
+		return "", false, nil
+	}
+	if payload.ExpireAt != 0 && time.Now().UnixNano()/int64(time.Millisecond) >= payload.ExpireAt {
+		return "", false, nil
+	}
+	rw.jar.setPayload(payload)
+	sessionID, err = hubOption.encryptStoreKey(payload.StoreKey)
+	if err != nil {
+		return
+	}
+	return sessionID, true, nil
+}
+
+// Write 修改 session 时已经写入了 cookie，此处不需要再写入 sessionID
+func (rw *cookieStoreReadWriter) Write(ctx context.Context, hubOption HubOption, sessionID string) (err error) {
+	return nil
+}
+func (rw *cookieStoreReadWriter) Destroy(ctx context.Context, hubOption HubOption) (err error) {
+	return rw.jar.clear()
+}
+
+// cookieJar 当前请求的 session 数据，每次修改后重新加密并写入 set-cookie
+// 只能保存一个 session，行为与 RedisStore 中的一个 key 一致
+type cookieJar struct {
+	mu     sync.Mutex
+	store  *CookieStore
+	writer http.ResponseWriter
+	option HubOptionCookie
+	// 请求中 cookie 的数量，写入时删除多余的 cookie
+	requestChunks int
+	storeKey      string
+	// values 为 nil 时表示没有 session
+	values map[string]string
+	// 零值表示永不过期
+	expireAt time.Time
+}
+
+func (j *cookieJar) load(hubOption HubOption, requestChunks int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.option = hubOption.Cookie
+	j.requestChunks = requestChunks
+}
+func (j *cookieJar) setPayload(payload cookieStorePayload) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.storeKey = payload.StoreKey
+	j.values = payload.Values
+	if j.values == nil {
+		j.values = map[string]string{}
+	}
+	j.expireAt = time.Time{}
+	if payload.ExpireAt != 0 {
+		j.expireAt = time.Unix(0, payload.ExpireAt*int64(time.Millisecond))
+	}
+}
+
+// alive 返回 storeKey 对应的未过期的数据，调用方需持有锁
+func (j *cookieJar) alive(storeKey string) (values map[string]string, has bool) {
+	if j.values == nil || j.storeKey != storeKey {
+		return nil, false
+	}
+	if j.expireAt.IsZero() == false && time.Now().Before(j.expireAt) == false {
+		return nil, false
+	}
+	return j.values, true
+}
+
+// update 在副本上修改数据，写入 set-cookie 成功后再保存，调用方需持有锁
+// values 为空时删除 cookie
+func (j *cookieJar) update(storeKey string, values map[string]string, expireAt time.Time) (err error) {
+	if j.option.Name == "" {
+		return errCookieStoreWithoutReadWriter
+	}
+	var cookies []*http.Cookie
+	if len(values) != 0 {
+		payload := cookieStorePayload{
+			StoreKey: storeKey,
+			Values:   values,
+		}
+		option := j.option
+		if expireAt.IsZero() == false {
+			payload.ExpireAt = expireAt.UnixNano() / int64(time.Millisecond)
+			option.MaxAge = int(time.Until(expireAt)/time.Second) + 1
+		}
+		data, err := j.store.encode(payload, j.option.Name)
+		if err != nil {
+			return err
+		}
+		chunkSize := j.store.option.ChunkSize
+		if len(data) > chunkSize*j.store.option.MaxChunks {
+			return xerr.WithStack(ErrCookieStoreTooLarge)
+		}
+		for i := 0; len(data) != 0; i++ {
+			size := chunkSize
+			if size > len(data) {
+				size = len(data)
+			}
+			option.Name = cookieChunkName(j.option.Name, i)
+			cookies = append(cookies, newCookieFromOption(data[:size], option))
+			data = data[size:]
+		}
+	}
+	// 删除请求中多余的 cookie
+	for i := len(cookies); i < j.requestChunks; i++ {
+		option := j.option
+		option.Name = cookieChunkName(j.option.Name, i)
+		option.MaxAge = -1
+		cookies = append(cookies, newCookieFromOption("", option))
+	}
+	j.replaceSetCookie(cookies)
+	if len(values) == 0 {
+		j.storeKey = ""
+		j.values = nil
+		j.expireAt = time.Time{}
+		return nil
+	}
+	j.storeKey = storeKey
+	j.values = values
+	j.expireAt = expireAt
+	return nil
+}
+
+// replaceSetCookie 删除之前写入的 set-cookie，避免同一个请求多次修改 session 时出现重复的 set-cookie
+func (j *cookieJar) replaceSetCookie(cookies []*http.Cookie) {
+	header := j.writer.Header()
+	var kept []string
+	for _, line := range header["Set-Cookie"] {
+		if strings.HasPrefix(line, j.option.Name+"=") || strings.HasPrefix(line, j.option.Name+".") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if len(kept) == 0 {
+		header.Del("Set-Cookie")
+	} else {
+		header["Set-Cookie"] = kept
+	}
+	for _, cookie := range cookies {
+		setCookie(j.writer, cookie, j.option)
+	}
+}
+func (j *cookieJar) clear() (err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.update("", nil, time.Time{})
+}
+func copyValues(values map[string]string) map[string]string {
+	copied := make(map[string]string, len(values))
+	for field, value := range values {
+		copied[field] = value
+	}
+	return copied
+}
+
+// writable 返回写入 storeKey 时使用的数据副本，与 redis HSET 一致: key 不存在时创建一个永不过期的 hash
+func (j *cookieJar) writable(storeKey string) (values map[string]string, expireAt time.Time, err error) {
+	values, has := j.alive(storeKey)
+	if has {
+		return copyValues(values), j.expireAt, nil
+	}
+	if _, otherHas := j.alive(j.storeKey); otherHas && j.storeKey != storeKey {
+		return nil, time.Time{}, xerr.New("goclub/session: CookieStore can only hold one session per request")
+	}
+	return map[string]string{}, time.Time{}, nil
+}
+func (j *cookieJar) InitSession(ctx context.Context, storeKey string, sessionTTL time.Duration) (err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	values, has := j.alive(storeKey)
+	if has {
+		values = copyValues(values)
+	} else {
+		values = map[string]string{}
+	}
+	values[createTimeField] = strconv.FormatInt(time.Now().Unix(), 10)
+	return j.update(storeKey, values, time.Now().Add(sessionTTL))
+}
+func (j *cookieJar) StoreKeyExists(ctx context.Context, storeKey string) (existed bool, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, existed = j.alive(storeKey)
+	return
+}
+func (j *cookieJar) StoreKeyRemainingTTL(ctx context.Context, storeKey string) (remainingTTL time.Duration, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, has := j.alive(storeKey)
+	if has == false || j.expireAt.IsZero() {
+		return 0, nil
+	}
+	return time.Until(j.expireAt), nil
+}
+func (j *cookieJar) RenewTTL(ctx context.Context, storeKey string, ttl time.Duration) (err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	values, has := j.alive(storeKey)
+	if has == false {
+		return
+	}
+	return j.update(storeKey, values, time.Now().Add(ttl))
+}
+func (j *cookieJar) Get(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	values, has := j.alive(storeKey)
+	if has == false {
+		return "", false, nil
+	}
+	value, hasValue = values[field]
+	return
+}
+func (j *cookieJar) Set(ctx context.Context, storeKey string, field string, value string) (err error) {
+	return j.BulkWrite(ctx, storeKey, map[string]string{field: value}, nil)
+}
+func (j *cookieJar) Delete(ctx context.Context, storeKey string, field string) (err error) {
+	return j.BulkWrite(ctx, storeKey, nil, []string{field})
+}
+func (j *cookieJar) Destroy(ctx context.Context, storeKey string) (err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, has := j.alive(storeKey); has == false {
+		return
+	}
+	return j.update("", nil, time.Time{})
+}
+func (j *cookieJar) Rename(ctx context.Context, oldStoreKey string, newStoreKey string) (renamed bool, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	values, has := j.alive(oldStoreKey)
+	if has == false {
+		return false, nil
+	}
+	err = j.update(newStoreKey, values, j.expireAt)
+	if err != nil {
+		return
+	}
+	return true, nil
+}
+func (j *cookieJar) GetAll(ctx context.Context, storeKey string) (values map[string]string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	values, has := j.alive(storeKey)
+	if has == false {
+		return map[string]string{}, nil
+	}
+	return copyValues(values), nil
+}
+func (j *cookieJar) BulkWrite(ctx context.Context, storeKey string, setValues map[string]string, deleteFields []string) (err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, has := j.alive(storeKey); has == false && len(setValues) == 0 {
+		return
+	}
+	values, expireAt, err := j.writable(storeKey)
+	if err != nil {
+		return
+	}
+	for field, value := range setValues {
+		values[field] = value
+	}
+	for _, field := range deleteFields {
+		delete(values, field)
+	}
+	return j.update(storeKey, values, expireAt)
+}
+func (j *cookieJar) Touch(ctx context.Context, storeKey string, ttl time.Duration, renewThreshold time.Duration) (existed bool, remaining time.Duration, evictedReason string, err error) {
+	// CookieStore 没有实现 StoreUserIndexer，session 不会被踢出，evictedReason 总是为空
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	values, has := j.alive(storeKey)
+	if has == false {
+		return false, 0, "", nil
+	}
+	if j.expireAt.IsZero() == false {
+		remaining = time.Until(j.expireAt)
+	}
+	if remaining < renewThreshold {
+		err = j.update(storeKey, values, time.Now().Add(ttl))
+		if err != nil {
+			return
+		}
+	}
+	return true, remaining, "", nil
+}
+func (j *cookieJar) RenewWithValues(ctx context.Context, storeKey string, ttl time.Duration, setValues map[string]string) (existed bool, evictedReason string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	values, has := j.alive(storeKey)
+	if has == false {
+		return false, "", nil
+	}
+	values = copyValues(values)
+	for field, value := range setValues {
+		values[field] = value
+	}
+	err = j.update(storeKey, values, time.Now().Add(ttl))
+	if err != nil {
+		return
+	}
+	return true, "", nil
+}
+func (j *cookieJar) AppendJSONArray(ctx context.Context, storeKey string, field string, element string) (err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	values, expireAt, err := j.writable(storeKey)
+	if err != nil {
+		return
+	}
+	value, hasValue := values[field]
+	value, err = appendJSONArray(field, value, hasValue, element)
+	if err != nil {
+		return
+	}
+	values[field] = value
+	return j.update(storeKey, values, expireAt)
+}
+func (j *cookieJar) GetDelete(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	values, has := j.alive(storeKey)
+	if has == false {
+		return "", false, nil
+	}
+	value, hasValue = values[field]
+	if hasValue == false {
+		return "", false, nil
+	}
+	values = copyValues(values)
+	delete(values, field)
+	err = j.update(storeKey, values, j.expireAt)
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
@@ -0,0 +1,139 @@
+package sess
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	xerr "github.com/goclub/error"
+	"net/http"
+)
+
+type HubOptionCSRF struct {
+	// 读取 token 的请求头，默认为 X-CSRF-Token
+	HeaderKey string
+	// 请求头中没有 token 时读取的表单字段，默认为 csrf_token
+	FormField string
+	// 验证失败时触发，不设置时 token 错误响应 403，其他错误响应 500
+	OnError func(writer http.ResponseWriter, request *http.Request, err error)
+}
+
+// ErrCSRFTokenInvalid 表示请求中没有 csrf token 或 token 与 session 不匹配
+var ErrCSRFTokenInvalid = xerr.New("goclub/session: csrf token invalid")
+
+const csrfSecretField = internalFieldPrefix + "csrf_secret"
+const csrfSecretLength = 32
+
+// CSRFToken 返回用于表单或请求头的 csrf token，session 中没有 csrf 秘钥时会生成并保存
+// 每次调用都会使用随机掩码生成不同的 token（防御 BREACH 攻击），同一个 session 的所有 token 都有效
+func (s Session) CSRFToken(ctx context.Context) (token string, err error) {
+	secret, has, err := s.csrfSecret(ctx)
+	if err != nil {
+		return
+	}
+	if has == false {
+		secret = make([]byte, csrfSecretLength)
+		_, err = rand.Read(secret)
+		if err != nil {
+			return "", xerr.WithStack(err)
+		}
+		err = s.Set(ctx, csrfSecretField, base64.RawURLEncoding.EncodeToString(secret))
+		if err != nil {
+			return
+		}
+	}
+	pad := make([]byte, csrfSecretLength)
+	_, err = rand.Read(pad)
+	if err != nil {
+		return "", xerr.WithStack(err)
+	}
+	masked := make([]byte, csrfSecretLength*2)
+	copy(masked, pad)
+	xorBytes(masked[csrfSecretLength:], pad, secret)
+	return base64.RawURLEncoding.EncodeToString(masked), nil
+}
+
+// VerifyCSRFToken 验证 token 是否由当前 session 的 CSRFToken() 生成
+func (s Session) VerifyCSRFToken(ctx context.Context, token string) (valid bool, err error) {
+	secret, has, err := s.csrfSecret(ctx)
+	if err != nil {
+		return
+	}
+	if has == false {
+		return false, nil
+	}
+	masked, decodeErr := base64.RawURLEncoding.DecodeString(token)
+	if decodeErr != nil || len(masked) != csrfSecretLength*2 {
+		return false, nil
+	}
+	unmasked := make([]byte, csrfSecretLength)
+	xorBytes(unmasked, masked[:csrfSecretLength], masked[csrfSecretLength:])
+	return subtle.ConstantTimeCompare(unmasked, secret) == 1, nil
+}
+func xorBytes(dst []byte, a []byte, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
+func (s Session) csrfSecret(ctx context.Context) (secret []byte, has bool, err error) {
+	value, has, err := s.Get(ctx, csrfSecretField)
+	if err != nil {
+		return
+	}
+	if has == false {
+		return nil, false, nil
+	}
+	secret, err = base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(secret) != csrfSecretLength {
+		return nil, false, xerr.WithStack(&DecodeError{
+			Field: csrfSecretField,
+			Value: value,
+			Err:   xerr.New("goclub/session: invalid csrf secret"),
+		})
+	}
+	return secret, true, nil
+}
+
+// CSRFMiddleware 在 POST PUT PATCH DELETE 等非安全方法的请求中验证 csrf token
+// 必须在 hub.Middleware() 之后使用，例如 hub.Middleware(hub.CSRFMiddleware(handler))
+// token 通过 session.CSRFToken() 生成，从 HubOption{}.CSRF.HeaderKey 请求头或 HubOption{}.CSRF.FormField 表单字段读取
+func (hub Hub) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(writer, request)
+			return
+		}
+		ctx := request.Context()
+		session, has := FromContext(ctx)
+		if has == false {
+			hub.csrfError(writer, request, xerr.New("goclub/session: hub.CSRFMiddleware() must be used after hub.Middleware()"))
+			return
+		}
+		token := request.Header.Get(hub.option.CSRF.HeaderKey)
+		if token == "" {
+			token = request.PostFormValue(hub.option.CSRF.FormField)
+		}
+		valid, err := session.VerifyCSRFToken(ctx, token)
+		if err != nil {
+			hub.csrfError(writer, request, err)
+			return
+		}
+		if valid == false {
+			hub.csrfError(writer, request, ErrCSRFTokenInvalid)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+func (hub Hub) csrfError(writer http.ResponseWriter, request *http.Request, err error) {
+	if hub.option.CSRF.OnError != nil {
+		hub.option.CSRF.OnError(writer, request, err)
+		return
+	}
+	if xerr.Is(err, ErrCSRFTokenInvalid) {
+		http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
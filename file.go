@@ -0,0 +1,541 @@
+package sess
+
+import (
+	"context"
+	"encoding/json"
+	xerr "github.com/goclub/error"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewFileStore 创建基于文件系统的 Store，适用于没有 redis 的单机部署
+// 每个 session 保存为 {Dir}/{storeKey 前两位}/{storeKey}.json，文件内容为 hash 的 json
+// 过期时间保存在文件的修改时间(mtime)中，续期只需要修改 mtime 而不需要重写文件
+// 写入时先写临时文件再 rename 保证原子性，同一个 storeKey 的写操作会加锁
+// 注意: 锁只在进程内有效，不要让多个进程使用同一个 Dir
+func NewFileStore(option FileStoreOption) (store *FileStore, err error) {
+	if option.Dir == "" {
+		return nil, xerr.New("goclub/session: NewFileStore(option) option.Dir can not be empty string")
+	}
+	err = os.MkdirAll(option.Dir, 0700)
+	if err != nil {
+		return nil, xerr.WithStack(err)
+	}
+	if option.SweepInterval == 0 {
+		option.SweepInterval = time.Minute
+	}
+	store = &FileStore{
+		option: option,
+		done:   make(chan struct{}),
+	}
+	if option.SweepInterval > 0 {
+		go store.sweeper(option.SweepInterval)
+	}
+	return store, nil
+}
+
+type FileStoreOption struct {
+	// 保存 session 文件的目录
+	Dir string
+	// 删除过期文件的间隔, 默认为 1 分钟, 小于 0 时不启动后台删除
+	SweepInterval time.Duration
+	// 后台删除过期文件失败时触发, 用于监控
+	OnSweepError func(err error)
+}
+type FileStore struct {
+	option    FileStoreOption
+	locks     [256]sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// 文件 mtime 无法表示"永不过期"，使用一个足够远的时间代替（与 redis 中 HSET 一个不存在的 key 的行为一致）
+var fileStoreNeverExpire = time.Unix(1<<33, 0)
+
+const fileStoreExt = ".json"
+
+// 临时文件名为 .tmp-{storeKey}.{随机数}，sweeper 根据 storeKey 加锁后删除崩溃时遗留的临时文件
+const fileStoreTempPrefix = ".tmp-"
+
+// storeKey 会作为文件名，只允许安全的字符，避免路径穿越
+var fileStoreKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{2,}$`)
+
+// Close 停止后台删除过期文件的 goroutine，可重复调用
+func (m *FileStore) Close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+}
+func (m *FileStore) sweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			err := m.DeleteExpired()
+			if err != nil && m.option.OnSweepError != nil {
+				m.option.OnSweepError(err)
+			}
+		}
+	}
+}
+
+// DeleteExpired 删除所有过期的文件和崩溃时遗留的临时文件，一般情况下不需要手动调用
+func (m *FileStore) DeleteExpired() (err error) {
+	now := time.Now()
+	err = filepath.Walk(m.option.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), fileStoreTempPrefix) {
+			return m.deleteStaleTemp(path, info.Name())
+		}
+		if strings.HasSuffix(info.Name(), fileStoreExt) == false {
+			return nil
+		}
+		if fileStoreExpired(info.ModTime(), now) == false {
+			return nil
+		}
+		storeKey := strings.TrimSuffix(info.Name(), fileStoreExt)
+		mu := m.lock(storeKey)
+		defer mu.Unlock()
+		// 加锁后再次检查，避免删除刚刚续期的文件
+		info, err = os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fileStoreExpired(info.ModTime(), time.Now()) == false {
+			return nil
+		}
+		err = os.Remove(path)
+		if err != nil && os.IsNotExist(err) == false {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	return
+}
+
+// deleteStaleTemp 删除 write() 在写入和 rename 之间崩溃遗留的临时文件
+// 同一个 storeKey 的 write() 会持有锁，加锁后仍然存在的临时文件一定是遗留的
+// 文件名不是 .tmp-{storeKey}.{随机数} 格式的文件不是 FileStore 创建的，不会删除
+func (m *FileStore) deleteStaleTemp(path string, name string) (err error) {
+	storeKey := strings.TrimPrefix(name, fileStoreTempPrefix)
+	dot := strings.Index(storeKey, ".")
+	if dot == -1 {
+		return nil
+	}
+	storeKey = storeKey[:dot]
+	if fileStoreKeyRegexp.MatchString(storeKey) == false {
+		return nil
+	}
+	mu := m.lock(storeKey)
+	defer mu.Unlock()
+	err = os.Remove(path)
+	if err != nil && os.IsNotExist(err) == false {
+		return err
+	}
+	return nil
+}
+func fileStoreExpired(expireAt time.Time, now time.Time) bool {
+	return now.Before(expireAt) == false
+}
+func (m *FileStore) lockIndex(storeKey string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(storeKey))
+	return h.Sum32() % uint32(len(m.locks))
+}
+func (m *FileStore) lock(storeKey string) *sync.Mutex {
+	mu := &m.locks[m.lockIndex(storeKey)]
+	mu.Lock()
+	return mu
+}
+
+// lockPair 按顺序对两个 storeKey 加锁避免死锁
+func (m *FileStore) lockPair(a string, b string) (unlock func()) {
+	indexA, indexB := m.lockIndex(a), m.lockIndex(b)
+	if indexA == indexB {
+		m.locks[indexA].Lock()
+		return m.locks[indexA].Unlock
+	}
+	if indexA > indexB {
+		indexA, indexB = indexB, indexA
+	}
+	m.locks[indexA].Lock()
+	m.locks[indexB].Lock()
+	return func() {
+		m.locks[indexB].Unlock()
+		m.locks[indexA].Unlock()
+	}
+}
+func (m *FileStore) path(storeKey string) (path string, err error) {
+	if fileStoreKeyRegexp.MatchString(storeKey) == false {
+		return "", xerr.New("goclub/session: FileStore storeKey contains invalid characters: " + strconv.Quote(storeKey))
+	}
+	return filepath.Join(m.option.Dir, storeKey[:2], storeKey+fileStoreExt), nil
+}
+
+// load 读取未过期的 hash，文件不存在或已过期时 has = false
+func (m *FileStore) load(path string) (values map[string]string, expireAt time.Time, has bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, time.Time{}, false, nil
+		}
+		return nil, time.Time{}, false, xerr.WithStack(err)
+	}
+	defer file.Close()
+	// 通过同一个文件描述符读取 mtime 和内容，保证两者属于同一次写入
+	info, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, false, xerr.WithStack(err)
+	}
+	expireAt = info.ModTime()
+	if fileStoreExpired(expireAt, time.Now()) {
+		return nil, time.Time{}, false, nil
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, time.Time{}, false, xerr.WithStack(err)
+	}
+	values = map[string]string{}
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		return nil, time.Time{}, false, xerr.WrapPrefix("goclub/session: FileStore decode "+path+" fail", err)
+	}
+	return values, expireAt, true, nil
+}
+
+// write 先写临时文件并设置 mtime 再 rename，保证读取方不会读到写了一半的文件
+func (m *FileStore) write(path string, values map[string]string, expireAt time.Time) (err error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	storeKey := strings.TrimSuffix(filepath.Base(path), fileStoreExt)
+	temp, err := ioutil.TempFile(dir, fileStoreTempPrefix+storeKey+".*")
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	tempName := temp.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tempName)
+		}
+	}()
+	_, err = temp.Write(data)
+	if err != nil {
+		_ = temp.Close()
+		return xerr.WithStack(err)
+	}
+	err = temp.Close()
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	err = os.Chtimes(tempName, expireAt, expireAt)
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	err = os.Rename(tempName, path)
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	return
+}
+func (m *FileStore) InitSession(ctx context.Context, storeKey string, sessionTTL time.Duration) (err error) {
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	mu := m.lock(storeKey)
+	defer mu.Unlock()
+	values, _, has, err := m.load(path)
+	if err != nil {
+		return
+	}
+	if has == false {
+		values = map[string]string{}
+	}
+	values[createTimeField] = strconv.FormatInt(time.Now().Unix(), 10)
+	return m.write(path, values, time.Now().Add(sessionTTL))
+}
+func (m *FileStore) StoreKeyExists(ctx context.Context, storeKey string) (existed bool, err error) {
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	_, _, existed, err = m.load(path)
+	return
+}
+func (m *FileStore) StoreKeyRemainingTTL(ctx context.Context, storeKey string) (remainingTTL time.Duration, err error) {
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, xerr.WithStack(err)
+	}
+	expireAt := info.ModTime()
+	// 与 RedisStore 一致: key 不存在或永不过期时返回 0
+	if fileStoreExpired(expireAt, time.Now()) || expireAt.Equal(fileStoreNeverExpire) {
+		return 0, nil
+	}
+	return time.Until(expireAt), nil
+}
+func (m *FileStore) RenewTTL(ctx context.Context, storeKey string, ttl time.Duration) (err error) {
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	mu := m.lock(storeKey)
+	defer mu.Unlock()
+	info, err := os.Stat(path)
+	if err != nil {
+		// 与 redis PEXPIRE 一致: key 不存在时什么都不做
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return xerr.WithStack(err)
+	}
+	if fileStoreExpired(info.ModTime(), time.Now()) {
+		return nil
+	}
+	expireAt := time.Now().Add(ttl)
+	err = os.Chtimes(path, expireAt, expireAt)
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	return
+}
+func (m *FileStore) Get(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error) {
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	values, _, has, err := m.load(path)
+	if err != nil {
+		return
+	}
+	if has == false {
+		return "", false, nil
+	}
+	value, hasValue = values[field]
+	return
+}
+func (m *FileStore) Set(ctx context.Context, storeKey string, field string, value string) (err error) {
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	mu := m.lock(storeKey)
+	defer mu.Unlock()
+	values, expireAt, has, err := m.load(path)
+	if err != nil {
+		return
+	}
+	// 与 redis HSET 一致: key 不存在时创建一个永不过期的 hash
+	if has == false {
+		values = map[string]string{}
+		expireAt = fileStoreNeverExpire
+	}
+	values[field] = value
+	return m.write(path, values, expireAt)
+}
+func (m *FileStore) Delete(ctx context.Context, storeKey string, field string) (err error) {
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	mu := m.lock(storeKey)
+	defer mu.Unlock()
+	values, expireAt, has, err := m.load(path)
+	if err != nil {
+		return
+	}
+	if has == false {
+		return
+	}
+	if _, hasValue := values[field]; hasValue == false {
+		return
+	}
+	delete(values, field)
+	// 与 redis 一致: hash 中没有 field 时 key 也不存在了
+	if len(values) == 0 {
+		return m.remove(path)
+	}
+	return m.write(path, values, expireAt)
+}
+func (m *FileStore) Destroy(ctx context.Context, storeKey string) (err error) {
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	mu := m.lock(storeKey)
+	defer mu.Unlock()
+	return m.remove(path)
+}
+func (m *FileStore) remove(path string) (err error) {
+	err = os.Remove(path)
+	if err != nil && os.IsNotExist(err) == false {
+		return xerr.WithStack(err)
+	}
+	return nil
+}
+func (m *FileStore) Rename(ctx context.Context, oldStoreKey string, newStoreKey string) (renamed bool, err error) {
+	oldPath, err := m.path(oldStoreKey)
+	if err != nil {
+		return
+	}
+	newPath, err := m.path(newStoreKey)
+	if err != nil {
+		return
+	}
+	unlock := m.lockPair(oldStoreKey, newStoreKey)
+	defer unlock()
+	info, err := os.Stat(oldPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, xerr.WithStack(err)
+	}
+	if fileStoreExpired(info.ModTime(), time.Now()) {
+		return false, nil
+	}
+	err = os.MkdirAll(filepath.Dir(newPath), 0700)
+	if err != nil {
+		return false, xerr.WithStack(err)
+	}
+	// rename 会保留 mtime 即保留过期时间
+	err = os.Rename(oldPath, newPath)
+	if err != nil {
+		return false, xerr.WithStack(err)
+	}
+	return true, nil
+}
+func (m *FileStore) GetAll(ctx context.Context, storeKey string) (values map[string]string, err error) {
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	values, _, has, err := m.load(path)
+	if err != nil {
+		return
+	}
+	if has == false {
+		return map[string]string{}, nil
+	}
+	return values, nil
+}
+func (m *FileStore) BulkWrite(ctx context.Context, storeKey string, setValues map[string]string, deleteFields []string) (err error) {
+	if len(setValues) == 0 && len(deleteFields) == 0 {
+		return
+	}
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	mu := m.lock(storeKey)
+	defer mu.Unlock()
+	values, expireAt, has, err := m.load(path)
+	if err != nil {
+		return
+	}
+	if has == false {
+		values = map[string]string{}
+		expireAt = fileStoreNeverExpire
+	}
+	for field, value := range setValues {
+		values[field] = value
+	}
+	for _, field := range deleteFields {
+		delete(values, field)
+	}
+	if len(values) == 0 {
+		return m.remove(path)
+	}
+	return m.write(path, values, expireAt)
+}
+func (m *FileStore) GetDelete(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error) {
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	mu := m.lock(storeKey)
+	defer mu.Unlock()
+	values, expireAt, has, err := m.load(path)
+	if err != nil {
+		return
+	}
+	if has == false {
+		return "", false, nil
+	}
+	value, hasValue = values[field]
+	if hasValue == false {
+		return "", false, nil
+	}
+	delete(values, field)
+	if len(values) == 0 {
+		err = m.remove(path)
+	} else {
+		err = m.write(path, values, expireAt)
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+func (m *FileStore) AppendJSONArray(ctx context.Context, storeKey string, field string, element string) (err error) {
+	path, err := m.path(storeKey)
+	if err != nil {
+		return
+	}
+	mu := m.lock(storeKey)
+	defer mu.Unlock()
+	values, expireAt, has, err := m.load(path)
+	if err != nil {
+		return
+	}
+	// 与 Set 一致: key 不存在时创建一个永不过期的 hash
+	if has == false {
+		values = map[string]string{}
+		expireAt = fileStoreNeverExpire
+	}
+	value, hasValue := values[field]
+	value, err = appendJSONArray(field, value, hasValue, element)
+	if err != nil {
+		return
+	}
+	values[field] = value
+	return m.write(path, values, expireAt)
+}
@@ -0,0 +1,105 @@
+package sess
+
+import (
+	"context"
+	"encoding/json"
+	xerr "github.com/goclub/error"
+)
+
+// flash 消息以 json 数组保存在 __goclub_session_flash_{kind} 字段中
+const flashFieldPrefix = internalFieldPrefix + "flash_"
+
+func flashField(kind string) string {
+	return flashFieldPrefix + kind
+}
+
+// AddFlash 添加一条 flash 消息，通常在 POST 处理成功后重定向前调用，在下一个页面通过 session.Flashes() 读取
+// kind 用于区分消息类型，例如 "success" "error"
+// flash 不经过 HubOption{}.RequestCache，会直接写入 store
+// Store 实现了 StoreAppender 时添加是原子操作，否则多个请求同时添加同一类型的 flash 时可能丢失消息
+func (s Session) AddFlash(ctx context.Context, kind string, message string) (err error) {
+	storeKey, err := s.backed(ctx)
+	if err != nil {
+		return
+	}
+	field := flashField(kind)
+	s.forgetCache(field)
+	if appender, ok := s.hub.store.(StoreAppender); ok {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return xerr.WithStack(err)
+		}
+		return appender.AppendJSONArray(ctx, storeKey, field, string(data))
+	}
+	value, hasValue, err := s.hub.store.Get(ctx, storeKey, field)
+	if err != nil {
+		return
+	}
+	messages, err := decodeFlashes(field, value, hasValue)
+	if err != nil {
+		return
+	}
+	messages = append(messages, message)
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	return s.hub.store.Set(ctx, storeKey, field, string(data))
+}
+
+// Flashes 读取并清除 kind 类型的所有 flash 消息，没有消息时返回空切片
+// Store 实现了 StoreGetDeleter 时读取和清除是原子操作，多个标签页同时请求时消息只会被读取一次
+func (s Session) Flashes(ctx context.Context, kind string) (messages []string, err error) {
+	if s.unbacked() {
+		return nil, nil
+	}
+	storeKey := s.storeKey()
+	field := flashField(kind)
+	s.forgetCache(field)
+	if getDeleter, ok := s.hub.store.(StoreGetDeleter); ok {
+		value, hasValue, err := getDeleter.GetDelete(ctx, storeKey, field)
+		if err != nil {
+			return nil, err
+		}
+		return decodeFlashes(field, value, hasValue)
+	}
+	value, hasValue, err := s.hub.store.Get(ctx, storeKey, field)
+	if err != nil {
+		return
+	}
+	if hasValue == false {
+		return nil, nil
+	}
+	err = s.hub.store.Delete(ctx, storeKey, field)
+	if err != nil {
+		return
+	}
+	return decodeFlashes(field, value, hasValue)
+}
+func decodeFlashes(field string, value string, hasValue bool) (messages []string, err error) {
+	if hasValue == false {
+		return nil, nil
+	}
+	err = json.Unmarshal([]byte(value), &messages)
+	if err != nil {
+		return nil, xerr.WithStack(&DecodeError{
+			Field: field,
+			Value: value,
+			Err:   err,
+		})
+	}
+	return
+}
+
+// forgetCache 清除 HubOption{}.RequestCache 中 field 的缓存，用于绕过缓存直接读写 store 的操作
+func (s Session) forgetCache(field string) {
+	if s.cached() == false {
+		return
+	}
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	cache := s.state.cache
+	delete(cache.values, field)
+	delete(cache.dirty, field)
+	delete(cache.deleted, field)
+}
@@ -8,5 +8,6 @@ require (
 	github.com/goclub/rand v0.0.0-20230405034429-d098be951d8b
 	github.com/goclub/redis v0.0.0-20220216084217-8ab278de5024
 	github.com/google/uuid v1.3.0
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/stretchr/testify v1.7.0
 )
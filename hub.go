@@ -5,6 +5,8 @@ import (
 	xerr "github.com/goclub/error"
 	"github.com/google/uuid"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -30,22 +32,76 @@ func NewHub(store Store, option HubOption) (hub *Hub, err error) {
 	if option.Header.Key == "" {
 		option.Header.Key = "session"
 	}
+	// grpc metadata key 必须是小写
+	if option.Metadata.Key == "" {
+		option.Metadata.Key = "session"
+	}
+	if option.Authorization.ResponseHeaderKey == "" {
+		option.Authorization.ResponseHeaderKey = "X-Session-Id"
+	}
 	if option.Cookie.Path == "" {
 		option.Cookie.Path = "/"
 	}
+	err = option.Cookie.check()
+	if err != nil {
+		return nil, err
+	}
+	if option.CSRF.HeaderKey == "" {
+		option.CSRF.HeaderKey = "X-CSRF-Token"
+	}
+	if option.CSRF.FormField == "" {
+		option.CSRF.FormField = "csrf_token"
+	}
+	if option.Codec == nil {
+		option.Codec = JSONCodec{}
+	}
+	if option.RenewPolicy == nil {
+		option.RenewPolicy = RenewAtFraction{Fraction: 0.5}
+	}
+	if policy, ok := option.RenewPolicy.(RenewIdleTimeout); ok && policy.IdleTimeout <= 0 {
+		return nil, xerr.New("goclub/sesison: NewHub(store, option) option.RenewPolicy RenewIdleTimeout{}.IdleTimeout must be greater than 0")
+	}
 	// 默认加密解密方式
 	if option.Security == nil {
 		option.Security = DefaultSecurity{}
 	}
+	var keyLength int
 	switch option.Security.(type) {
-	case DefaultSecurity:
-		if len(option.SecureKey) != 32 {
+	case DefaultSecurity, *DefaultSecurity, AEADSecurity, *AEADSecurity:
+		keyLength = 32
+	}
+	if option.SecureKeyring.enabled() {
+		err = option.SecureKeyring.check(keyLength)
+		if err != nil {
+			return nil, err
+		}
+		// 使用 SecureKeyring 时 SecureKey 只用于解密没有秘钥 ID 前缀的旧 sessionID
+		if keyLength != 0 && len(option.SecureKey) != 0 && len(option.SecureKey) != keyLength {
 			return nil, xerr.New("goclub/sesison:  NewHub(store, option) option.SecureKey length must be 32")
 		}
+	} else if keyLength != 0 && len(option.SecureKey) != keyLength {
+		return nil, xerr.New("goclub/sesison:  NewHub(store, option) option.SecureKey length must be 32")
 	}
 	if store == nil {
 		return nil, xerr.New("goclub/sesison: NewHub(store, option) store can not be nil")
 	}
+	if option.RequestCache {
+		// RequestCache 在响应之后才写入，CookieStore 无法再修改 set-cookie
+		if _, ok := store.(*CookieStore); ok {
+			return nil, xerr.New("goclub/sesison: NewHub(store, option) option.RequestCache can not be used with sess.CookieStore")
+		}
+		if _, ok := store.(BulkStore); ok == false {
+			return nil, xerr.New("goclub/sesison: NewHub(store, option) option.RequestCache store must implement sess.BulkStore")
+		}
+	}
+	if option.MaxSessionsPerUser < 0 {
+		return nil, xerr.New("goclub/sesison: NewHub(store, option) option.MaxSessionsPerUser can not be negative")
+	}
+	if option.MaxSessionsPerUser > 0 {
+		if _, ok := store.(StoreUserIndexer); ok == false {
+			return nil, xerr.New("goclub/sesison: NewHub(store, option) option.MaxSessionsPerUser store must implement sess.StoreUserIndexer")
+		}
+	}
 
 	hub = &Hub{
 		store:  store,
@@ -56,16 +112,56 @@ func NewHub(store Store, option HubOption) (hub *Hub, err error) {
 
 type HubOption struct {
 	// (必填) sessionID 与 storeKey 的加密解密秘钥 设置长度为 32 的 []byte
+	// 配置了 SecureKeyring 时为选填，只用于解密没有秘钥 ID 前缀的旧 sessionID
 	SecureKey []byte
+	// 需要轮换秘钥时使用，配置后新的 sessionID 使用 SecureKeyring.Primary 加密
+	SecureKeyring SecureKeyring
 	// cookie 相关设置
 	Cookie HubOptionCookie
 	// sesison 过期时间，默认8小时
 	SessionTTL time.Duration
+	// session 最长有效期，不设置则不限制
+	// 自动续期会让活跃用户的 session 永不过期，设置后从创建 session 开始超过 AbsoluteTTL 时不再续期并视为过期
+	// 创建时间读取自 store 中的 __goclub_session_create_time 字段
+	AbsoluteTTL time.Duration
+	// 续期策略，默认为 sess.RenewAtFraction{Fraction: 0.5}: 剩余有效期小于 SessionTTL 的一半时续期
+	// 内置 sess.RenewNever{} sess.RenewAtFraction{} sess.RenewEvery{} sess.RenewIdleTimeout{}
+	RenewPolicy RenewPolicy
 	// header 相关设置
 	Header HubOptionHeader
-	// header 相关设置
+	// sess.AuthorizationReadWriter 相关设置
+	Authorization HubOptionAuthorization
+	// sess.MetadataReadWriter 相关设置
+	Metadata HubOptionMetadata
 	// 加密方式，不填则为 goclub/sesion 默认 aes 加密
+	// 建议使用 sess.AEADSecurity{} (AES-256-GCM 认证加密)
 	Security Security
+	// session.SetValue() session.GetValue() 等类型辅助方法使用的编码方式，默认为 sess.JSONCodec{}
+	// 内置 sess.JSONCodec{} sess.GobCodec{} sess.BinaryCodec{}
+	Codec Codec
+	// 开启后 session.Load() 遇到 session 中存在但 struct 中没有对应字段的 field 时返回 *sess.BindError
+	// 默认忽略这些 field，因为同一个 session 通常会被多个 struct 分别读取
+	StrictLoad bool
+	// hub.Middleware() 相关设置
+	Middleware HubOptionMiddleware
+	// hub.CSRFMiddleware() 相关设置
+	CSRF HubOptionCSRF
+	// 延迟创建 session，适用于有大量爬虫和健康检查等匿名请求的场景
+	// 开启后客户端没有 sessionID 时 GetSessionByReadWriter 返回未创建的 Session，
+	// 直到第一次调用 session.Set() 时才会在 store 中创建 session 并将 sessionID 写入客户端
+	// 未创建的 Session 调用 Get() 返回 hasValue = false，ID() 返回空字符串，且都不会访问 store
+	LazySession bool
+	// 请求级缓存，开启后第一次调用 session.Get() 时一次性读取整个 session，之后的读取不再访问 store
+	// session.Set() 和 session.Delete() 只修改缓存，调用 session.Flush() 时一次性写入 store
+	// hub.Middleware() 会在 handler 写入响应前自动调用 session.Flush()
+	// 需要 Store 实现 BulkStore
+	RequestCache bool
+	// 每个用户最多同时存在的 session 数量，0 表示不限制，设置为 1 即单点登录
+	// session.BindUser() 时检查，超过时根据 SessionLimitPolicy 处理，需要 Store 实现 StoreUserIndexer
+	// 被踢出的 session 下一次请求时 GetSessionByReadWriter 返回 *sess.SessionEvictedError
+	MaxSessionsPerUser int
+	// 超过 MaxSessionsPerUser 时的策略，默认为 sess.SessionLimitEvictOldest
+	SessionLimitPolicy SessionLimitPolicy
 	// 当sessionID 解码为 storeKey 后在 store 中不存在时触发
 	// 用于监控系统排查恶意攻击或 sessionID 过期
 	// ctx 可以用 ctx.WithValue 传递 requestID 便于排查问题
@@ -84,7 +180,39 @@ type HubOptionCookie struct {
 	// Path 默认为 int(HubOption{}.SessionTTL.Seconds())
 	MaxAge int
 	Secure bool
+	// SameSite 默认不设置(由浏览器决定，现代浏览器视为 Lax)，设置为 http.SameSiteNoneMode 时必须开启 Secure
+	SameSite http.SameSite
+	// 默认开启 HttpOnly，前端 js 需要读取 sessionID 时设置为 true
+	DisableHttpOnly bool
+	// 添加 Partitioned 属性(CHIPS)，用于第三方 iframe 等跨站场景，必须开启 Secure
+	Partitioned bool
 }
+
+// check 检查 cookie 配置是否符合浏览器的规则，不符合规则的 cookie 会被浏览器忽略
+func (option HubOptionCookie) check() error {
+	if option.SameSite == http.SameSiteNoneMode && option.Secure == false {
+		return xerr.New("goclub/session: NewHub(store, option) option.Cookie.SameSite is http.SameSiteNoneMode, option.Cookie.Secure must be true")
+	}
+	if option.Partitioned && option.Secure == false {
+		return xerr.New("goclub/session: NewHub(store, option) option.Cookie.Partitioned is true, option.Cookie.Secure must be true")
+	}
+	if strings.HasPrefix(option.Name, "__Secure-") && option.Secure == false {
+		return xerr.New("goclub/session: NewHub(store, option) option.Cookie.Name has __Secure- prefix, option.Cookie.Secure must be true")
+	}
+	if strings.HasPrefix(option.Name, "__Host-") {
+		if option.Secure == false {
+			return xerr.New("goclub/session: NewHub(store, option) option.Cookie.Name has __Host- prefix, option.Cookie.Secure must be true")
+		}
+		if option.Path != "/" {
+			return xerr.New("goclub/session: NewHub(store, option) option.Cookie.Name has __Host- prefix, option.Cookie.Path must be /")
+		}
+		if option.Domain != "" {
+			return xerr.New("goclub/session: NewHub(store, option) option.Cookie.Name has __Host- prefix, option.Cookie.Domain must be empty")
+		}
+	}
+	return nil
+}
+
 type HubOptionHeader struct {
 	// Key 建议设置为 session  (若留空则为 session)
 	Key string
@@ -94,18 +222,20 @@ type HubOptionHeader struct {
 // 微信小程序和 app 场景下可能在登录成功时可能需要手动创建 SessionID
 // 所以提供 NewSessionID 发放
 func (hub Hub) NewSessionID(ctx context.Context) (sessionID string, err error) {
-	storeKey := uuid.New().String()
-	var sessionIDBytes []byte
-	sessionIDBytes, err = hub.option.Security.Encrypt([]byte(storeKey), hub.option.SecureKey)
+	sessionID, _, err = hub.initSession(ctx)
+	return
+}
+func (hub Hub) initSession(ctx context.Context) (sessionID string, storeKey string, err error) {
+	storeKey = uuid.New().String()
+	sessionID, err = hub.option.encryptStoreKey(storeKey)
 	if err != nil {
 		return
 	}
-	sessionID = string(sessionIDBytes)
-	err = hub.store.InitSession(ctx, storeKey, hub.option.SessionTTL)
+	err = hub.store.InitSession(ctx, storeKey, hub.option.initSessionTTL())
 	if err != nil {
 		return
 	}
-	return sessionID, nil
+	return sessionID, storeKey, nil
 }
 
 func (hub Hub) GetSessionBySessionID(ctx context.Context, sessionID string) (session Session, sessionExpired bool, err error) {
@@ -123,6 +253,7 @@ func (hub Hub) getSessionByReadWriter(ctx context.Context, sessionID string, rw
 	if rw == nil {
 		rw = EmptyHttpReadWirter{}
 	}
+	hub = hub.withRequestStore(rw)
 	if sessionID == "" {
 		// session 为空时候返回 has = false
 		// 如果返回错误，会降低 goclub/session 的易用性
@@ -131,40 +262,65 @@ func (hub Hub) getSessionByReadWriter(ctx context.Context, sessionID string, rw
 		}
 		return Session{}, false, nil
 	}
-	var storeKeyBytes []byte
-	storeKeyBytes, err = hub.option.Security.Decrypt([]byte(sessionID), hub.option.SecureKey)
+	storeKey, primaryKey, err := hub.option.decryptSessionID(sessionID)
 	if err != nil {
 		return Session{}, false, err
 	}
-	storeKey := string(storeKeyBytes)
-	session = Session{
-		sessionID: sessionID,
-		storeKey:  storeKey,
-		hub:       hub,
-		rw:        rw,
-	}
+	session = newSession(hub, rw, sessionID, storeKey)
 	// 此处的验证可避免 key 过期或恶意猜测key进行攻击
-	has, err = session.existed(ctx)
+	has, evictedReason, err := hub.touch(ctx, storeKey)
 	if err != nil {
 		return
 	}
 	if has == false && hub.option.OnStoreKeyDoesNotExist != nil {
 		hub.option.OnStoreKeyDoesNotExist(ctx, sessionID, storeKey)
 	}
-	// 实现自动续期
-	remainingTTL, err := session.hub.store.StoreKeyRemainingTTL(ctx, session.storeKey)
-	if err != nil {
+	// 被踢出的 session 返回错误而不是创建新的 session，便于告知客户端在其他地方登录了
+	if has && evictedReason != "" {
+		err = hub.endEvicted(ctx, storeKey, rw, evictedReason)
 		return
 	}
-	if remainingTTL < session.hub.option.SessionTTL/2 {
-		err = session.hub.store.RenewTTL(ctx, session.storeKey, session.hub.option.SessionTTL)
+	// sessionID 使用已轮换的秘钥加密时以 SecureKeyring.Primary 重新签发
+	if has && primaryKey == false {
+		var newSessionID string
+		newSessionID, err = hub.option.encryptStoreKey(storeKey)
 		if err != nil {
 			return
 		}
+		err = rw.Write(ctx, hub.option, newSessionID)
+		if err != nil {
+			return
+		}
+		session.setKey(newSessionID, storeKey)
 	}
 	return
 }
 
+// initSessionTTL 返回创建 session 时的有效期，不超过 AbsoluteTTL
+// 使用 RenewIdleTimeout 时也不超过 IdleTimeout 和 MaxLifetime，否则 SessionTTL 较大时空闲超时不会生效
+func (option HubOption) initSessionTTL() time.Duration {
+	ttl := option.SessionTTL
+	limits := []time.Duration{option.AbsoluteTTL}
+	if policy, ok := option.RenewPolicy.(RenewIdleTimeout); ok {
+		limits = append(limits, policy.IdleTimeout, policy.MaxLifetime)
+	}
+	for _, limit := range limits {
+		if limit > 0 && limit < ttl {
+			ttl = limit
+		}
+	}
+	return ttl
+}
+
+// parseUnixTime 解析 store 中以 unix 秒保存的时间字段
+func parseUnixTime(value string) (createdAt time.Time, err error) {
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, xerr.New("goclub/session: session time field must be unix timestamp, got " + strconv.Quote(value))
+	}
+	return time.Unix(unix, 0), nil
+}
+
 func (hub Hub) GetSessionByCookie(ctx context.Context, writer http.ResponseWriter, request *http.Request) (Session, error) {
 	rw := CookieReadWriter{
 		Writer:  writer,
@@ -181,3 +337,11 @@ func (hub Hub) GetSessionByHeader(ctx context.Context, writer http.ResponseWrite
 	s, err := hub.GetSessionByReadWriter(ctx, rw)
 	return s, err
 }
+func (hub Hub) GetSessionByAuthorization(ctx context.Context, writer http.ResponseWriter, header http.Header) (Session, error) {
+	rw := AuthorizationReadWriter{
+		Writer: writer,
+		Header: header,
+	}
+	s, err := hub.GetSessionByReadWriter(ctx, rw)
+	return s, err
+}
@@ -0,0 +1,112 @@
+package sess
+
+import (
+	xerr "github.com/goclub/error"
+	"regexp"
+	"strings"
+)
+
+// SecureKeyring 用于轮换 sessionID 的加密秘钥
+// 新的 sessionID 使用 Primary 加密，并以 "{Primary.ID}." 作为前缀，解密时根据前缀选择秘钥
+// 轮换秘钥时将旧的 Primary 移动到 Retired，使用旧秘钥的 sessionID 会在下次请求时自动以 Primary 重新签发
+type SecureKeyring struct {
+	// 用于加密和解密的秘钥
+	Primary SecureKeyringKey
+	// 已轮换的秘钥，只用于解密
+	Retired []SecureKeyringKey
+}
+type SecureKeyringKey struct {
+	// 秘钥 ID，会作为 sessionID 的前缀，只能包含字母数字和 _ -
+	ID string
+	// 秘钥，使用 DefaultSecurity 或 AEADSecurity 时长度必须为 32
+	Key []byte
+}
+
+// sessionID 中秘钥 ID 与密文的分隔符，base64 url 编码不会出现 "."
+const secureKeyIDSeparator = "."
+
+var secureKeyIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func (keyring SecureKeyring) enabled() bool {
+	return keyring.Primary.ID != "" || len(keyring.Primary.Key) != 0
+}
+func (keyring SecureKeyring) keys() (keys []SecureKeyringKey) {
+	return append([]SecureKeyringKey{keyring.Primary}, keyring.Retired...)
+}
+func (keyring SecureKeyring) find(id string) (key SecureKeyringKey, has bool) {
+	for _, item := range keyring.keys() {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return SecureKeyringKey{}, false
+}
+func (keyring SecureKeyring) check(keyLength int) (err error) {
+	ids := map[string]bool{}
+	for _, item := range keyring.keys() {
+		if secureKeyIDRegexp.MatchString(item.ID) == false {
+			return xerr.New("goclub/session: NewHub(store, option) option.SecureKeyring key id can only contain letters, numbers, _ and -, id: " + item.ID)
+		}
+		if ids[item.ID] {
+			return xerr.New("goclub/session: NewHub(store, option) option.SecureKeyring key id can not be repeated, id: " + item.ID)
+		}
+		ids[item.ID] = true
+		if keyLength != 0 && len(item.Key) != keyLength {
+			return xerr.New("goclub/session: NewHub(store, option) option.SecureKeyring key length must be 32, id: " + item.ID)
+		}
+	}
+	return
+}
+
+// encryptStoreKey 将 storeKey 加密为 sessionID，配置了 SecureKeyring 时使用 Primary 加密并添加秘钥 ID 前缀
+func (option HubOption) encryptStoreKey(storeKey string) (sessionID string, err error) {
+	if option.SecureKeyring.enabled() == false {
+		sessionIDBytes, err := option.Security.Encrypt([]byte(storeKey), option.SecureKey)
+		if err != nil {
+			return "", err
+		}
+		return string(sessionIDBytes), nil
+	}
+	primary := option.SecureKeyring.Primary
+	sessionIDBytes, err := option.Security.Encrypt([]byte(storeKey), primary.Key)
+	if err != nil {
+		return
+	}
+	return primary.ID + secureKeyIDSeparator + string(sessionIDBytes), nil
+}
+
+// decryptSessionID 将 sessionID 解密为 storeKey
+// 当 sessionID 不是使用 SecureKeyring.Primary 加密，或是通过 AEADSecurity{}.Legacy 解密时 primary = false，调用方应当重新签发 sessionID
+func (option HubOption) decryptSessionID(sessionID string) (storeKey string, primary bool, err error) {
+	var storeKeyBytes []byte
+	var legacy bool
+	if option.SecureKeyring.enabled() == false {
+		storeKeyBytes, legacy, err = option.decrypt([]byte(sessionID), option.SecureKey)
+		if err != nil {
+			return
+		}
+		return string(storeKeyBytes), legacy == false, nil
+	}
+	index := strings.Index(sessionID, secureKeyIDSeparator)
+	// 没有秘钥 ID 前缀的是使用 SecureKeyring 之前通过 SecureKey 加密的 sessionID
+	if index == -1 {
+		if len(option.SecureKey) == 0 {
+			return "", false, xerr.New("goclub/session: sessionID does not have secure key id, sess.HubOption{}.SecureKeyring is wrong or someone forged a incorrect session")
+		}
+		storeKeyBytes, _, err = option.decrypt([]byte(sessionID), option.SecureKey)
+		if err != nil {
+			return
+		}
+		return string(storeKeyBytes), false, nil
+	}
+	id := sessionID[:index]
+	key, has := option.SecureKeyring.find(id)
+	if has == false {
+		return "", false, xerr.New("goclub/session: sessionID secure key id not found, sess.HubOption{}.SecureKeyring is wrong or someone forged a incorrect session")
+	}
+	storeKeyBytes, legacy, err = option.decrypt([]byte(sessionID[index+len(secureKeyIDSeparator):]), key.Key)
+	if err != nil {
+		return
+	}
+	return string(storeKeyBytes), id == option.SecureKeyring.Primary.ID && legacy == false, nil
+}
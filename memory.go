@@ -0,0 +1,394 @@
+package sess
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NewMemoryStore 创建进程内存储，适用于单元测试和不依赖 redis 的单机工具
+// 后台会启动一个清理过期 session 的 goroutine，不再使用时调用 Close() 停止
+func NewMemoryStore() *MemoryStore {
+	return NewMemoryStoreWithOption(MemoryStoreOption{})
+}
+
+type MemoryStoreOption struct {
+	// 清理过期 session 的间隔，默认为 1 分钟，小于 0 时不启动后台清理
+	// 已过期但尚未清理的 session 不会被读取到，只是仍然占用内存
+	JanitorInterval time.Duration
+}
+
+func NewMemoryStoreWithOption(option MemoryStoreOption) *MemoryStore {
+	if option.JanitorInterval == 0 {
+		option.JanitorInterval = time.Minute
+	}
+	m := &MemoryStore{
+		data:  map[string]*memoryHash{},
+		users: map[string]map[string]time.Time{},
+		done:  make(chan struct{}),
+	}
+	if option.JanitorInterval > 0 {
+		go m.janitor(option.JanitorInterval)
+	}
+	return m
+}
+
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string]*memoryHash
+	// userID => storeKey => 绑定时间
+	users     map[string]map[string]time.Time
+	done      chan struct{}
+	closeOnce sync.Once
+}
+type memoryHash struct {
+	values map[string]string
+	// expireAt 为零值时表示永不过期（与 redis 中 HSET 一个不存在的 key 的行为一致）
+	expireAt time.Time
+}
+
+func (h *memoryHash) expired(now time.Time) bool {
+	return h.expireAt.IsZero() == false && now.Before(h.expireAt) == false
+}
+
+// Close 停止后台清理 goroutine，可重复调用
+func (m *MemoryStore) Close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+}
+func (m *MemoryStore) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.deleteExpired()
+		}
+	}
+}
+func (m *MemoryStore) deleteExpired() {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, hash := range m.data {
+		if hash.expired(now) {
+			m.deleteHash(key)
+		}
+	}
+}
+
+// deleteHash 删除 hash 并从用户索引中移除，调用方需持有锁
+func (m *MemoryStore) deleteHash(storeKey string) {
+	hash, has := m.data[storeKey]
+	if has == false {
+		return
+	}
+	delete(m.data, storeKey)
+	if userID, bound := hash.values[userIDField]; bound {
+		m.unindexUser(userID, storeKey)
+	}
+}
+
+// deleteFields 删除 hash 中的 field，删除 userID 字段时同时从用户索引中移除
+// 与 redis 一致: hash 中没有 field 时 key 也不存在了，调用方需持有锁
+func (m *MemoryStore) deleteFields(storeKey string, hash *memoryHash, fields ...string) {
+	for _, field := range fields {
+		if userID, bound := hash.values[userIDField]; bound && field == userIDField {
+			m.unindexUser(userID, storeKey)
+		}
+		delete(hash.values, field)
+	}
+	if len(hash.values) == 0 {
+		m.deleteHash(storeKey)
+	}
+}
+
+// Len 返回 store 中 key 的数量，包含已过期但尚未被后台清理的 key，用于监控内存占用
+func (m *MemoryStore) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.data)
+}
+
+// unindexUser 从用户索引中移除 storeKey，调用方需持有锁
+func (m *MemoryStore) unindexUser(userID string, storeKey string) {
+	index := m.users[userID]
+	delete(index, storeKey)
+	if len(index) == 0 {
+		delete(m.users, userID)
+	}
+}
+
+// getHash 返回未过期的 hash，调用方需持有锁
+func (m *MemoryStore) getHash(storeKey string) (hash *memoryHash, has bool) {
+	hash, has = m.data[storeKey]
+	if has == false {
+		return nil, false
+	}
+	if hash.expired(time.Now()) {
+		return nil, false
+	}
+	return hash, true
+}
+func (m *MemoryStore) InitSession(ctx context.Context, storeKey string, sessionTTL time.Duration) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(storeKey)
+	if has == false {
+		hash = &memoryHash{values: map[string]string{}}
+		m.data[storeKey] = hash
+	}
+	hash.values[createTimeField] = strconv.FormatInt(time.Now().Unix(), 10)
+	hash.expireAt = time.Now().Add(sessionTTL)
+	return
+}
+func (m *MemoryStore) StoreKeyExists(ctx context.Context, storeKey string) (existed bool, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, existed = m.getHash(storeKey)
+	return
+}
+func (m *MemoryStore) StoreKeyRemainingTTL(ctx context.Context, storeKey string) (remainingTTL time.Duration, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	hash, has := m.getHash(storeKey)
+	// 与 RedisStore 一致: key 不存在或永不过期时返回 0
+	if has == false || hash.expireAt.IsZero() {
+		return 0, nil
+	}
+	return time.Until(hash.expireAt), nil
+}
+func (m *MemoryStore) RenewTTL(ctx context.Context, storeKey string, ttl time.Duration) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(storeKey)
+	// 与 redis PEXPIRE 一致: key 不存在时什么都不做
+	if has == false {
+		return
+	}
+	hash.expireAt = time.Now().Add(ttl)
+	return
+}
+func (m *MemoryStore) Get(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	hash, has := m.getHash(storeKey)
+	if has == false {
+		return "", false, nil
+	}
+	value, hasValue = hash.values[field]
+	return
+}
+func (m *MemoryStore) Set(ctx context.Context, storeKey string, field string, value string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(storeKey)
+	// 与 redis HSET 一致: key 不存在时创建一个永不过期的 hash
+	if has == false {
+		hash = &memoryHash{values: map[string]string{}}
+		m.data[storeKey] = hash
+	}
+	hash.values[field] = value
+	return
+}
+func (m *MemoryStore) Delete(ctx context.Context, storeKey string, field string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(storeKey)
+	if has == false {
+		return
+	}
+	m.deleteFields(storeKey, hash, field)
+	return
+}
+func (m *MemoryStore) Destroy(ctx context.Context, storeKey string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteHash(storeKey)
+	return
+}
+func (m *MemoryStore) Rename(ctx context.Context, oldStoreKey string, newStoreKey string) (renamed bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(oldStoreKey)
+	if has == false {
+		return false, nil
+	}
+	m.deleteHash(newStoreKey)
+	m.data[newStoreKey] = hash
+	delete(m.data, oldStoreKey)
+	if userID, bound := hash.values[userIDField]; bound {
+		if boundAt, indexed := m.users[userID][oldStoreKey]; indexed {
+			delete(m.users[userID], oldStoreKey)
+			m.users[userID][newStoreKey] = boundAt
+		}
+	}
+	return true, nil
+}
+func (m *MemoryStore) GetAll(ctx context.Context, storeKey string) (values map[string]string, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	values = map[string]string{}
+	hash, has := m.getHash(storeKey)
+	if has == false {
+		return
+	}
+	for field, value := range hash.values {
+		values[field] = value
+	}
+	return
+}
+func (m *MemoryStore) BulkWrite(ctx context.Context, storeKey string, setValues map[string]string, deleteFields []string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(storeKey)
+	if has == false {
+		if len(setValues) == 0 {
+			return
+		}
+		hash = &memoryHash{values: map[string]string{}}
+		m.data[storeKey] = hash
+	}
+	for field, value := range setValues {
+		hash.values[field] = value
+	}
+	m.deleteFields(storeKey, hash, deleteFields...)
+	return
+}
+func (m *MemoryStore) Touch(ctx context.Context, storeKey string, ttl time.Duration, renewThreshold time.Duration) (existed bool, remaining time.Duration, evictedReason string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(storeKey)
+	if has == false {
+		return false, 0, "", nil
+	}
+	if hash.expireAt.IsZero() == false {
+		remaining = time.Until(hash.expireAt)
+	}
+	if reason, evicted := hash.values[evictedField]; evicted {
+		return true, remaining, reason, nil
+	}
+	if remaining < renewThreshold {
+		hash.expireAt = time.Now().Add(ttl)
+	}
+	return true, remaining, "", nil
+}
+func (m *MemoryStore) RenewWithValues(ctx context.Context, storeKey string, ttl time.Duration, setValues map[string]string) (existed bool, evictedReason string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(storeKey)
+	if has == false {
+		return false, "", nil
+	}
+	if reason, evicted := hash.values[evictedField]; evicted {
+		return true, reason, nil
+	}
+	for field, value := range setValues {
+		hash.values[field] = value
+	}
+	hash.expireAt = time.Now().Add(ttl)
+	return true, "", nil
+}
+func (m *MemoryStore) AppendJSONArray(ctx context.Context, storeKey string, field string, element string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(storeKey)
+	if has == false {
+		hash = &memoryHash{values: map[string]string{}}
+		m.data[storeKey] = hash
+	}
+	value, hasValue := hash.values[field]
+	value, err = appendJSONArray(field, value, hasValue, element)
+	if err != nil {
+		return
+	}
+	hash.values[field] = value
+	return
+}
+func (m *MemoryStore) GetDelete(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(storeKey)
+	if has == false {
+		return "", false, nil
+	}
+	value, hasValue = hash.values[field]
+	if hasValue == false {
+		return "", false, nil
+	}
+	m.deleteFields(storeKey, hash, field)
+	return value, true, nil
+}
+func (m *MemoryStore) BindUser(ctx context.Context, storeKey string, userID string, meta UserSessionMeta) (bound bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(storeKey)
+	if has == false {
+		return false, nil
+	}
+	if oldUserID, ok := hash.values[userIDField]; ok && oldUserID != userID {
+		m.unindexUser(oldUserID, storeKey)
+	}
+	hash.values[userIDField] = userID
+	hash.values[userAgentField] = meta.UserAgent
+	hash.values[userIPField] = meta.IP
+	if m.users[userID] == nil {
+		m.users[userID] = map[string]time.Time{}
+	}
+	m.users[userID][storeKey] = time.Now()
+	return true, nil
+}
+func (m *MemoryStore) EvictSession(ctx context.Context, storeKey string, setValues map[string]string, ttl time.Duration) (evicted bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash, has := m.getHash(storeKey)
+	if has == false {
+		return false, nil
+	}
+	if userID, bound := hash.values[userIDField]; bound {
+		m.unindexUser(userID, storeKey)
+	}
+	values := map[string]string{}
+	if createTime, hasCreateTime := hash.values[createTimeField]; hasCreateTime {
+		values[createTimeField] = createTime
+	}
+	for field, value := range setValues {
+		values[field] = value
+	}
+	hash.values = values
+	if hash.expireAt.IsZero() {
+		hash.expireAt = time.Now().Add(ttl)
+	}
+	return true, nil
+}
+func (m *MemoryStore) UserSessions(ctx context.Context, userID string) (sessions []UserSession, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for storeKey, boundAt := range m.users[userID] {
+		hash, has := m.getHash(storeKey)
+		if has == false || hash.values[userIDField] != userID {
+			m.unindexUser(userID, storeKey)
+			continue
+		}
+		var createdAt time.Time
+		if value, ok := hash.values[createTimeField]; ok {
+			createdAt, err = parseUnixTime(value)
+			if err != nil {
+				return
+			}
+		}
+		sessions = append(sessions, UserSession{
+			StoreKey:  storeKey,
+			CreatedAt: createdAt,
+			BoundAt:   boundAt,
+			UserAgent: hash.values[userAgentField],
+			IP:        hash.values[userIPField],
+		})
+	}
+	sortUserSessions(sessions)
+	return
+}
@@ -0,0 +1,218 @@
+package sess
+
+import (
+	"context"
+	xerr "github.com/goclub/error"
+	"strings"
+	"sync"
+)
+
+type HubOptionMetadata struct {
+	// 传递 sessionID 的 metadata key，默认为 session
+	Key string
+}
+
+// MetadataCarrier 键值对元数据，与 grpc 的 metadata.MD 方法一致，metadata.MD 可以直接作为 MetadataCarrier 使用
+type MetadataCarrier interface {
+	Get(key string) []string
+	Set(key string, values ...string)
+}
+
+// MetadataMap 进程内的 MetadataCarrier，与 metadata.MD 一样 key 不区分大小写
+type MetadataMap map[string][]string
+
+func (m MetadataMap) Get(key string) []string {
+	return m[strings.ToLower(key)]
+}
+func (m MetadataMap) Set(key string, values ...string) {
+	if len(values) == 0 {
+		return
+	}
+	m[strings.ToLower(key)] = values
+}
+
+// MetadataReadWriter 从请求的 metadata 读取 sessionID，新的 sessionID 写入响应的 metadata
+// 适用于 grpc 等不使用 net/http 的服务
+type MetadataReadWriter struct {
+	// 请求的 metadata，例如 grpc 的 metadata.FromIncomingContext(ctx)
+	Incoming MetadataCarrier
+	// 响应的 metadata，需要调用方发送给客户端，例如 grpc.SetHeader(ctx, md)
+	Outgoing MetadataCarrier
+}
+
+func (rw MetadataReadWriter) Read(ctx context.Context, hubOption HubOption) (sessionID string, has bool, err error) {
+	if len(hubOption.Metadata.Key) == 0 {
+		return "", false, xerr.New("goclub/session: you forget set HubOption{}.Metadata.Key")
+	}
+	if rw.Incoming == nil {
+		return "", false, nil
+	}
+	values := rw.Incoming.Get(hubOption.Metadata.Key)
+	if len(values) == 0 || len(values[0]) == 0 {
+		return "", false, nil
+	}
+	return values[0], true, nil
+}
+func (rw MetadataReadWriter) Write(ctx context.Context, hubOption HubOption, sessionID string) (err error) {
+	if len(hubOption.Metadata.Key) == 0 {
+		return xerr.New("goclub/session: you forget set HubOption{}.Metadata.Key")
+	}
+	if rw.Outgoing == nil {
+		return xerr.New("goclub/session: MetadataReadWriter{}.Outgoing can not be nil")
+	}
+	rw.Outgoing.Set(hubOption.Metadata.Key, sessionID)
+	return
+}
+
+// Destroy 客户端需要自行删除保存的 sessionID
+func (rw MetadataReadWriter) Destroy(ctx context.Context, hubOption HubOption) (err error) {
+	return
+}
+func (hub Hub) GetSessionByMetadata(ctx context.Context, incoming MetadataCarrier, outgoing MetadataCarrier) (Session, error) {
+	rw := MetadataReadWriter{
+		Incoming: incoming,
+		Outgoing: outgoing,
+	}
+	s, err := hub.GetSessionByReadWriter(ctx, rw)
+	return s, err
+}
+
+// MetadataTransport 描述如何从 ctx 读取请求的 metadata 以及如何发送响应的 metadata
+// 使用 grpc 时:
+//
+//	sess.MetadataTransport{
+//		Incoming: func(ctx context.Context) sess.MetadataCarrier {
+//			md, _ := metadata.FromIncomingContext(ctx)
+//			return md
+//		},
+//		SendHeader: func(ctx context.Context, outgoing sess.MetadataMap) error {
+//			return grpc.SetHeader(ctx, metadata.MD(outgoing))
+//		},
+//	}
+type MetadataTransport struct {
+	Incoming   func(ctx context.Context) MetadataCarrier
+	SendHeader func(ctx context.Context, outgoing MetadataMap) error
+}
+
+func (transport MetadataTransport) incoming(ctx context.Context) MetadataCarrier {
+	if transport.Incoming == nil {
+		return nil
+	}
+	return transport.Incoming(ctx)
+}
+func (transport MetadataTransport) sendHeader(ctx context.Context, outgoing MetadataMap) error {
+	if len(outgoing) == 0 || transport.SendHeader == nil {
+		return nil
+	}
+	return transport.SendHeader(ctx, outgoing)
+}
+
+// UnaryServerSession 返回 unary 拦截器风格的函数，获取 Session 后注入到 ctx 中，handler 中通过 sess.FromContext(ctx) 获取
+// handler 执行后发送响应的 metadata（handler 返回错误时也会发送），所以 handler 中的 session.Regenerate() 也会通知客户端
+// 与 grpc 一起使用:
+//
+//	unary := hub.UnaryServerSession(transport)
+//	grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+//		return unary(ctx, req, handler)
+//	})
+func (hub Hub) UnaryServerSession(transport MetadataTransport) func(ctx context.Context, req interface{}, handler func(ctx context.Context, req interface{}) (interface{}, error)) (interface{}, error) {
+	return func(ctx context.Context, req interface{}, handler func(ctx context.Context, req interface{}) (interface{}, error)) (interface{}, error) {
+		outgoing := MetadataMap{}
+		session, err := hub.GetSessionByMetadata(ctx, transport.incoming(ctx), outgoing)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := handler(withSession(ctx, session), req)
+		// 开启 HubOption{}.RequestCache 时写入 handler 中的修改
+		flushErr := session.Flush(ctx)
+		// handler 返回错误时也发送，新的 sessionID 已经写入 store，客户端需要知道
+		sendErr := transport.sendHeader(ctx, outgoing)
+		if err != nil {
+			return resp, err
+		}
+		if flushErr != nil {
+			return nil, flushErr
+		}
+		if sendErr != nil {
+			return nil, sendErr
+		}
+		return resp, nil
+	}
+}
+
+// StreamServerSession 返回 stream 拦截器风格的函数，获取 Session 后注入到 ctx 中
+// stream 的响应 metadata 需要在第一条消息之前发送，handler 应当在第一次 SendMsg 前调用 sendHeader，
+// 这样 handler 中创建的 LazySession 或 session.Regenerate() 生成的 sessionID 也会通知客户端
+// sendHeader 只会发送一次，之后生成的 sessionID 无法通知客户端；handler 没有调用时在 handler 执行后发送（handler 返回错误时也会发送）
+// 开启 HubOption{}.RequestCache 时每次调用 sendHeader 都会先调用 session.Flush()，handler 执行后也会再调用一次
+// 与 grpc 一起使用时需要包装 grpc.ServerStream 以替换 Context() 并在 SendMsg 前发送 header:
+//
+//	stream := hub.StreamServerSession(transport)
+//	grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+//		return stream(ss.Context(), func(ctx context.Context, sendHeader func() error) error {
+//			return handler(srv, &serverStream{ServerStream: ss, ctx: ctx, sendHeader: sendHeader})
+//		})
+//	})
+//	func (s *serverStream) SendMsg(m interface{}) error {
+//		if err := s.sendHeader(); err != nil {
+//			return err
+//		}
+//		return s.ServerStream.SendMsg(m)
+//	}
+func (hub Hub) StreamServerSession(transport MetadataTransport) func(ctx context.Context, handler func(ctx context.Context, sendHeader func() error) error) error {
+	return func(ctx context.Context, handler func(ctx context.Context, sendHeader func() error) error) error {
+		header := &streamHeader{outgoing: MetadataMap{}}
+		session, err := hub.GetSessionByMetadata(ctx, transport.incoming(ctx), header)
+		if err != nil {
+			return err
+		}
+		// 发送消息前写入 handler 中的修改，客户端收到消息后发起的请求可以读取到修改
+		sendHeader := func() error {
+			err := session.Flush(ctx)
+			if err != nil {
+				return err
+			}
+			return header.send(ctx, transport)
+		}
+		err = handler(withSession(ctx, session), sendHeader)
+		// sendHeader 会先写入 handler 中的修改，handler 返回错误时也发送
+		sendErr := sendHeader()
+		if err != nil {
+			return err
+		}
+		return sendErr
+	}
+}
+
+// streamHeader stream 的响应 metadata，SendMsg 和 handler 可能在不同的 goroutine 中，所以需要加锁
+type streamHeader struct {
+	mu       sync.Mutex
+	outgoing MetadataMap
+	sent     bool
+}
+
+func (h *streamHeader) Get(key string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.outgoing.Get(key)
+}
+func (h *streamHeader) Set(key string, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.outgoing.Set(key, values...)
+}
+
+// send 只发送一次，与 grpc 一致: 第一条消息发送后 header 不能再修改
+func (h *streamHeader) send(ctx context.Context, transport MetadataTransport) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sent {
+		return nil
+	}
+	h.sent = true
+	outgoing := MetadataMap{}
+	for key, values := range h.outgoing {
+		outgoing[key] = values
+	}
+	return transport.sendHeader(ctx, outgoing)
+}
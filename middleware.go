@@ -0,0 +1,200 @@
+package sess
+
+import (
+	"bufio"
+	"context"
+	xerr "github.com/goclub/error"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type HubOptionMiddleware struct {
+	// 传输 sessionID 的方式，默认为 MiddlewareTransportCookie
+	Transport MiddlewareTransport
+	// 自定义 SessionHttpReadWriter，设置后忽略 Transport
+	ReadWriter func(writer http.ResponseWriter, request *http.Request) SessionHttpReadWriter
+	// 跳过的路径前缀，例如 "/static/"，跳过的请求不会访问 store
+	SkipPathPrefixes []string
+	// 自定义跳过规则，返回 true 时跳过
+	Skip func(request *http.Request) bool
+	// 获取 session 或 handler 写入响应前 session.Flush() 失败时触发，不设置时响应 500 且不暴露错误信息
+	// Authorization 请求头不是 Bearer 认证时响应 401，session 被踢出时响应 401
+	OnError func(writer http.ResponseWriter, request *http.Request, err error)
+}
+
+// MiddlewareTransport 中间件传输 sessionID 的方式
+type MiddlewareTransport uint8
+
+const (
+	// 等同于 hub.GetSessionByCookie()
+	MiddlewareTransportCookie MiddlewareTransport = iota
+	// 等同于 hub.GetSessionByHeader()
+	MiddlewareTransportHeader
+	// 等同于 hub.GetSessionByAuthorization()
+	MiddlewareTransportAuthorization
+)
+
+type sessionContextKey struct{}
+
+func withSession(ctx context.Context, session Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, session)
+}
+
+// FromContext 获取 hub.Middleware() 注入到 request.Context() 中的 Session
+func FromContext(ctx context.Context) (session Session, has bool) {
+	session, has = ctx.Value(sessionContextKey{}).(Session)
+	return
+}
+
+// Middleware 获取 Session 并注入到 request.Context() 中，在 handler 中使用 sess.FromContext(request.Context()) 获取
+// 通过 HubOption{}.Middleware 配置传输方式、跳过的路径和错误处理
+func (hub Hub) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if hub.skipMiddleware(request) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		ctx := request.Context()
+		session, err := hub.GetSessionByReadWriter(ctx, hub.middlewareReadWriter(writer, request))
+		if err != nil {
+			hub.middlewareError(writer, request, err)
+			return
+		}
+		flushWriter := &middlewareWriter{
+			ResponseWriter: writer,
+			hub:            hub,
+			request:        request,
+			session:        session,
+		}
+		next.ServeHTTP(flushWriter, request.WithContext(withSession(ctx, session)))
+		// handler 没有写入响应时在这里写入 handler 中的修改
+		if flushWriter.wroteHeader == false {
+			_ = flushWriter.flush()
+		}
+	})
+}
+
+// middlewareWriter 开启 HubOption{}.RequestCache 时在 handler 写入响应前调用 session.Flush()，
+// 保证客户端收到响应（例如重定向）后发起的下一个请求能读取到 handler 中的修改，
+// Flush 失败时还没有写入响应，可以通过 OnError 响应错误
+// 每次写入前都会 Flush，所以写入之间的修改也会保存，最后一次写入之后的修改需要 handler 手动调用 session.Flush()
+type middlewareWriter struct {
+	http.ResponseWriter
+	hub         Hub
+	request     *http.Request
+	session     Session
+	wroteHeader bool
+	err         error
+}
+
+func (w *middlewareWriter) flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	err := w.session.Flush(w.request.Context())
+	if err != nil {
+		w.err = err
+		if w.wroteHeader == false {
+			w.wroteHeader = true
+			w.hub.middlewareError(w.ResponseWriter, w.request, err)
+		}
+	}
+	return err
+}
+func (w *middlewareWriter) WriteHeader(statusCode int) {
+	if w.flush() != nil {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+func (w *middlewareWriter) Write(data []byte) (int, error) {
+	err := w.flush()
+	if err != nil {
+		return 0, err
+	}
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush 实现 http.Flusher
+func (w *middlewareWriter) Flush() {
+	if w.flush() != nil {
+		return
+	}
+	w.wroteHeader = true
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack 实现 http.Hijacker，便于在 Middleware 之后使用 websocket
+func (w *middlewareWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	err := w.flush()
+	if err != nil {
+		return nil, nil, err
+	}
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if ok == false {
+		return nil, nil, xerr.New("goclub/session: http.ResponseWriter does not implement http.Hijacker")
+	}
+	w.wroteHeader = true
+	return hijacker.Hijack()
+}
+
+// Unwrap 用于 http.NewResponseController()
+func (w *middlewareWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+func (hub Hub) skipMiddleware(request *http.Request) bool {
+	option := hub.option.Middleware
+	for _, prefix := range option.SkipPathPrefixes {
+		if strings.HasPrefix(request.URL.Path, prefix) {
+			return true
+		}
+	}
+	if option.Skip != nil && option.Skip(request) {
+		return true
+	}
+	return false
+}
+func (hub Hub) middlewareReadWriter(writer http.ResponseWriter, request *http.Request) SessionHttpReadWriter {
+	option := hub.option.Middleware
+	if option.ReadWriter != nil {
+		return option.ReadWriter(writer, request)
+	}
+	switch option.Transport {
+	case MiddlewareTransportHeader:
+		return HeaderReadWriter{
+			Writer: writer,
+			Header: request.Header,
+		}
+	case MiddlewareTransportAuthorization:
+		return AuthorizationReadWriter{
+			Writer: writer,
+			Header: request.Header,
+		}
+	default:
+		return CookieReadWriter{
+			Writer:  writer,
+			Request: request,
+		}
+	}
+}
+func (hub Hub) middlewareError(writer http.ResponseWriter, request *http.Request, err error) {
+	if hub.option.Middleware.OnError != nil {
+		hub.option.Middleware.OnError(writer, request, err)
+		return
+	}
+	if _, asSchemeError := AsAuthorizationSchemeError(err); asSchemeError {
+		writer.Header().Set("WWW-Authenticate", bearerScheme)
+		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	if _, asEvictedError := AsSessionEvictedError(err); asEvictedError {
+		http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
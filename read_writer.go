@@ -14,12 +14,17 @@ type SessionHttpReadWriter interface {
 }
 
 func (hub Hub) GetSessionByReadWriter(ctx context.Context, rw SessionHttpReadWriter) (session Session, err error) {
+	hub = hub.withRequestStore(rw)
 	sessionID, has, err := rw.Read(ctx, hub.option)
 	if err != nil {
 		return
 	}
 	// 如果客户端没有session 则生成新的 session
 	if has == false {
+		// 延迟创建模式下等到第一次 Set 时再生成 session
+		if hub.option.LazySession {
+			return newUnbackedSession(hub, rw), nil
+		}
 		sessionID, err = hub.NewSessionID(ctx)
 		if err != nil {
 			return
@@ -37,6 +42,14 @@ func (hub Hub) GetSessionByReadWriter(ctx context.Context, rw SessionHttpReadWri
 	// session 如果过期和恶意攻击的情况 会 hasSession == false
 	// (可以在已经 NewSessionID 之后清除 store 的数据以测试这种情况,例如 redis flushdb)
 	if hasSession == false {
+		if hub.option.LazySession {
+			// 清除客户端已失效的 sessionID，避免每次请求都查询 store
+			err = rw.Destroy(ctx, hub.option)
+			if err != nil {
+				return Session{}, err
+			}
+			return newUnbackedSession(hub, rw), nil
+		}
 		// 过期和恶意攻击的两种情况都生成新的 session
 		sessionID, err := hub.NewSessionID(ctx)
 		if err != nil {
@@ -93,7 +106,7 @@ func (rw CookieReadWriter) Write(ctx context.Context, hubOption HubOption, sessi
 	if len(hubOption.Cookie.Name) == 0 {
 		return xerr.New("goclub/session: you forget set HubOption{}.Cookie.Name")
 	}
-	http.SetCookie(rw.Writer, newCookieFromOption(sessionID, hubOption.Cookie))
+	setCookie(rw.Writer, newCookieFromOption(sessionID, hubOption.Cookie), hubOption.Cookie)
 	return
 }
 
@@ -101,7 +114,7 @@ func (rw CookieReadWriter) Destroy(ctx context.Context, hubOption HubOption) (er
 	opt := hubOption.Cookie
 	opt.MaxAge = -1
 	newCookie := newCookieFromOption("", opt)
-	http.SetCookie(rw.Writer, newCookie)
+	setCookie(rw.Writer, newCookie, opt)
 	return
 }
 
@@ -14,6 +14,9 @@ func NewRedisStore(option RedisStoreOption) RedisStore {
 	}
 }
 
+// RedisStoreOption RedisStore 的配置
+// lua 脚本访问的 key 都通过 KEYS 传递，但不支持 redis cluster:
+// Rename 和用户索引(StoreUserIndexer)的 lua 会同时访问多个 session key 和用户索引 key，这些 key 在 cluster 中通常位于不同的 slot
 type RedisStoreOption struct {
 	Client         red.Connecter
 	StoreKeyPrefix string
@@ -25,6 +28,46 @@ type RedisStore struct {
 func (m RedisStore) getKey(storeKey string) (key string) {
 	return m.option.StoreKeyPrefix + ":" + storeKey
 }
+
+// userIndexKey 用户索引的 key，保存 storeKey 的 sorted set，score 为绑定时间(毫秒)
+func (m RedisStore) userIndexKey(userID string) string {
+	return m.option.StoreKeyPrefix + ":user:" + userID
+}
+
+// redisUserIDRetry 读取 userID 之后、执行 lua 之前 userID 被其他请求修改时的重试次数
+const redisUserIDRetry = 3
+
+// withUserID 读取 session 绑定的 userID 后调用 fn，用于在执行 lua 前确定需要访问的用户索引 key
+// lua 访问的 key 都通过 KEYS 传递，lua 中发现 userID 已被修改时 fn 返回 changed = true，重新读取后重试
+func (m RedisStore) withUserID(ctx context.Context, key string, fn func(userID string) (changed bool, err error)) (err error) {
+	client := m.option.Client
+	for i := 0; i < redisUserIDRetry; i++ {
+		userID, _, err := client.DoStringReply(ctx, []string{"HGET", key, userIDField})
+		if err != nil {
+			return err
+		}
+		changed, err := fn(userID)
+		if err != nil {
+			return err
+		}
+		if changed == false {
+			return nil
+		}
+	}
+	return xerr.New("goclub/session: RedisStore user id of session changed concurrently, retry later")
+}
+
+// userIndexMembers 返回用户索引中的 storeKey，按绑定时间升序排列
+func (m RedisStore) userIndexMembers(ctx context.Context, userID string) (storeKeys []string, err error) {
+	reply, err := m.option.Client.DoArrayStringReply(ctx, []string{"ZRANGE", m.userIndexKey(userID), "0", "-1"})
+	if err != nil {
+		return
+	}
+	for _, member := range reply {
+		storeKeys = append(storeKeys, member.String)
+	}
+	return
+}
 func (m RedisStore) InitSession(ctx context.Context, storeKey string, sessionTTL time.Duration) (err error) {
 	key := m.getKey(storeKey)
 	client := m.option.Client
@@ -38,8 +81,7 @@ func (m RedisStore) InitSession(ctx context.Context, storeKey string, sessionTTL
 	redis.call("HSET", key, field, nowUnix)
 	return redis.call("pexpire", key, ttl)
 	`
-	field := "__goclub_session_create_time"
-	evalKeys := []string{key, field}
+	evalKeys := []string{key, createTimeField}
 	argv := []string{strconv.FormatInt(time.Now().Unix(), 10), strconv.FormatInt(sessionTTL.Milliseconds(), 10)}
 	reply, isNil, err := client.Eval(ctx, red.Script{
 		KEYS:   evalKeys,
@@ -132,9 +174,492 @@ func (m RedisStore) Delete(ctx context.Context, storeKey string, field string) (
 func (m RedisStore) Destroy(ctx context.Context, storeKey string) (err error) {
 	key := m.getKey(storeKey)
 	client := m.option.Client
-	_, err = red.DEL{Key: key}.Do(ctx, client)
+	// lua 保证原子性，绑定了用户的 session 同时从用户索引中移除
+	// userID 与 ARGV[2] 不一致时返回 -1，由 withUserID 重试
+	script := `
+	local userID = redis.call("HGET", KEYS[1], ARGV[1]) or ""
+	if userID ~= ARGV[2] then
+		return -1
+	end
+	redis.call("DEL", KEYS[1])
+	if KEYS[2] then
+		redis.call("ZREM", KEYS[2], ARGV[3])
+	end
+	return 1
+	`
+	return m.withUserID(ctx, key, func(userID string) (changed bool, err error) {
+		keys := []string{key}
+		if userID != "" {
+			keys = append(keys, m.userIndexKey(userID))
+		}
+		reply, err := client.EvalWithoutNil(ctx, red.Script{
+			KEYS:   keys,
+			ARGV:   []string{userIDField, userID, storeKey},
+			Script: script,
+		})
+		if err != nil {
+			return
+		}
+		intReply, err := reply.Int64()
+		if err != nil {
+			return
+		}
+		return intReply == -1, nil
+	})
+}
+func (m RedisStore) Rename(ctx context.Context, oldStoreKey string, newStoreKey string) (renamed bool, err error) {
+	oldKey := m.getKey(oldStoreKey)
+	client := m.option.Client
+	// lua 保证原子性, RENAME 会保留 ttl，绑定了用户的 session 同时更新用户索引
+	// userID 与 ARGV[2] 不一致时返回 -1，由 withUserID 重试
+	script := `
+	if redis.call("EXISTS", KEYS[1]) == 0 then
+		return 0
+	end
+	local userID = redis.call("HGET", KEYS[1], ARGV[1]) or ""
+	if userID ~= ARGV[2] then
+		return -1
+	end
+	redis.call("RENAME", KEYS[1], KEYS[2])
+	if KEYS[3] then
+		local score = redis.call("ZSCORE", KEYS[3], ARGV[3])
+		if score then
+			redis.call("ZREM", KEYS[3], ARGV[3])
+			redis.call("ZADD", KEYS[3], score, ARGV[4])
+		end
+	end
+	return 1
+	`
+	err = m.withUserID(ctx, oldKey, func(userID string) (changed bool, err error) {
+		keys := []string{oldKey, m.getKey(newStoreKey)}
+		if userID != "" {
+			keys = append(keys, m.userIndexKey(userID))
+		}
+		reply, err := client.EvalWithoutNil(ctx, red.Script{
+			KEYS:   keys,
+			ARGV:   []string{userIDField, userID, oldStoreKey, newStoreKey},
+			Script: script,
+		})
+		if err != nil {
+			return
+		}
+		intReply, err := reply.Int64()
+		if err != nil {
+			return
+		}
+		renamed = intReply == 1
+		return intReply == -1, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return renamed, nil
+}
+func (m RedisStore) GetAll(ctx context.Context, storeKey string) (values map[string]string, err error) {
+	key := m.getKey(storeKey)
+	client := m.option.Client
+	reply, err := client.DoArrayStringReply(ctx, []string{"HGETALL", key})
 	if err != nil {
 		return
 	}
+	values = map[string]string{}
+	for i := 0; i+1 < len(reply); i += 2 {
+		values[reply[i].String] = reply[i+1].String
+	}
+	return
+}
+func (m RedisStore) BulkWrite(ctx context.Context, storeKey string, setValues map[string]string, deleteFields []string) (err error) {
+	if len(setValues) == 0 && len(deleteFields) == 0 {
+		return
+	}
+	key := m.getKey(storeKey)
+	client := m.option.Client
+	// lua 保证原子性
+	// ARGV: setCount, field1, value1, field2, value2 ..., deleteField1, deleteField2 ...
+	script := `
+	local key = KEYS[1]
+	local setCount = tonumber(ARGV[1])
+	for i = 1, setCount do
+		redis.call("HSET", key, ARGV[i * 2], ARGV[i * 2 + 1])
+	end
+	for i = setCount * 2 + 2, #ARGV do
+		redis.call("HDEL", key, ARGV[i])
+	end
+	return 1
+	`
+	argv := []string{strconv.Itoa(len(setValues))}
+	for _, field := range sortedFields(setValues) {
+		argv = append(argv, field, setValues[field])
+	}
+	argv = append(argv, deleteFields...)
+	_, err = client.EvalWithoutNil(ctx, red.Script{
+		KEYS:   []string{key},
+		ARGV:   argv,
+		Script: script,
+	})
+	if err != nil {
+		return
+	}
+	return
+}
+func (m RedisStore) Touch(ctx context.Context, storeKey string, ttl time.Duration, renewThreshold time.Duration) (existed bool, remaining time.Duration, evictedReason string, err error) {
+	client := m.option.Client
+	// lua 保证原子性，将 EXISTS PTTL HGET PEXPIRE 合并为一次请求
+	// 返回 {-1, ""} 表示 key 不存在，否则返回续期前的剩余毫秒数和踢出原因，被踢出的 session 不续期
+	script := `
+	local key = KEYS[1]
+	local pttl = redis.call("PTTL", key)
+	if pttl == -2 then
+		return {-1, ""}
+	end
+	if pttl == -1 then
+		pttl = 0
+	end
+	local evicted = redis.call("HGET", key, ARGV[3])
+	if evicted then
+		return {pttl, evicted}
+	end
+	if pttl < tonumber(ARGV[2]) then
+		redis.call("PEXPIRE", key, ARGV[1])
+	end
+	return {pttl, ""}
+	`
+	reply, err := client.EvalWithoutNil(ctx, red.Script{
+		KEYS: []string{m.getKey(storeKey)},
+		ARGV: []string{
+			strconv.FormatInt(ttl.Milliseconds(), 10),
+			strconv.FormatInt(renewThreshold.Milliseconds(), 10),
+			evictedField,
+		},
+		Script: script,
+	})
+	if err != nil {
+		return
+	}
+	values, err := reply.StringSlice()
+	if err != nil {
+		return
+	}
+	if len(values) != 2 {
+		return false, 0, "", xerr.New("goclub/session: RedisStore Touch unexpected reply length " + strconv.Itoa(len(values)))
+	}
+	pttl, err := strconv.ParseInt(values[0].String, 10, 64)
+	if err != nil {
+		return false, 0, "", xerr.WithStack(err)
+	}
+	if pttl < 0 {
+		return false, 0, "", nil
+	}
+	return true, time.Duration(pttl) * time.Millisecond, values[1].String, nil
+}
+func (m RedisStore) RenewWithValues(ctx context.Context, storeKey string, ttl time.Duration, setValues map[string]string) (existed bool, evictedReason string, err error) {
+	client := m.option.Client
+	// lua 保证原子性，key 不存在时返回 nil 且不会创建 key，被踢出时返回踢出原因且不做任何修改，成功时返回 ""
+	script := `
+	local key = KEYS[1]
+	if redis.call("EXISTS", key) == 0 then
+		return false
+	end
+	local evicted = redis.call("HGET", key, ARGV[2])
+	if evicted then
+		return evicted
+	end
+	for i = 3, #ARGV, 2 do
+		redis.call("HSET", key, ARGV[i], ARGV[i+1])
+	end
+	redis.call("PEXPIRE", key, ARGV[1])
+	return ""
+	`
+	argv := []string{strconv.FormatInt(ttl.Milliseconds(), 10), evictedField}
+	for _, field := range sortedFields(setValues) {
+		argv = append(argv, field, setValues[field])
+	}
+	reply, isNil, err := client.Eval(ctx, red.Script{
+		KEYS:   []string{m.getKey(storeKey)},
+		ARGV:   argv,
+		Script: script,
+	})
+	if err != nil {
+		return
+	}
+	if isNil {
+		return false, "", nil
+	}
+	evictedReason, err = reply.String()
+	if err != nil {
+		return
+	}
+	return true, evictedReason, nil
+}
+func (m RedisStore) AppendJSONArray(ctx context.Context, storeKey string, field string, element string) (err error) {
+	client := m.option.Client
+	// lua 保证原子性，数组由 json.Marshal 编码，以 [ 开头 ] 结尾
+	// 不是 json 数组时不修改并返回原值，由 go 返回 *sess.DecodeError，与 MemoryStore 一致
+	script := `
+	local value = redis.call("HGET", KEYS[1], ARGV[1])
+	if not value then
+		value = "[" .. ARGV[2] .. "]"
+	else
+		local trimmed = string.match(value, "^%s*(.-)%s*$")
+		if string.sub(trimmed, 1, 1) ~= "[" or string.sub(trimmed, -1) ~= "]" then
+			return value
+		end
+		if string.match(trimmed, "^%[%s*%]$") then
+			value = "[" .. ARGV[2] .. "]"
+		else
+			value = string.sub(trimmed, 1, -2) .. "," .. ARGV[2] .. "]"
+		end
+	end
+	redis.call("HSET", KEYS[1], ARGV[1], value)
+	return false
+	`
+	reply, isNil, err := client.Eval(ctx, red.Script{
+		KEYS:   []string{m.getKey(storeKey)},
+		ARGV:   []string{field, element},
+		Script: script,
+	})
+	if err != nil {
+		return
+	}
+	if isNil {
+		return
+	}
+	value, err := reply.String()
+	if err != nil {
+		return
+	}
+	return xerr.WithStack(&DecodeError{
+		Field: field,
+		Value: value,
+		Err:   xerr.New("value is not a json array"),
+	})
+}
+func (m RedisStore) GetDelete(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error) {
+	client := m.option.Client
+	// lua 保证原子性
+	script := `
+	local value = redis.call("HGET", KEYS[1], ARGV[1])
+	if value then
+		redis.call("HDEL", KEYS[1], ARGV[1])
+	end
+	return value
+	`
+	reply, isNil, err := client.Eval(ctx, red.Script{
+		KEYS:   []string{m.getKey(storeKey)},
+		ARGV:   []string{field},
+		Script: script,
+	})
+	if err != nil {
+		return
+	}
+	if isNil {
+		return "", false, nil
+	}
+	value, err = reply.String()
+	if err != nil {
+		return
+	}
+	return value, true, nil
+}
+func (m RedisStore) BindUser(ctx context.Context, storeKey string, userID string, meta UserSessionMeta) (bound bool, err error) {
+	key := m.getKey(storeKey)
+	client := m.option.Client
+	// lua 保证原子性，绑定时顺便清除用户索引中已过期的 storeKey
+	// KEYS: session, 用户索引, 旧用户索引, 用户索引中已有的 session ...
+	// ARGV: userIDField, userID, storeKey, 旧 userID, userAgentField, userAgent, ipField, ip, 绑定时间, 用户索引中已有的 storeKey ...
+	// 旧 userID 与 ARGV[4] 不一致时返回 -1，由 withUserID 重试
+	script := `
+	if redis.call("EXISTS", KEYS[1]) == 0 then
+		return 0
+	end
+	local oldUserID = redis.call("HGET", KEYS[1], ARGV[1]) or ""
+	if oldUserID ~= ARGV[4] then
+		return -1
+	end
+	if oldUserID ~= "" and oldUserID ~= ARGV[2] then
+		redis.call("ZREM", KEYS[3], ARGV[3])
+	end
+	redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+	redis.call("HSET", KEYS[1], ARGV[5], ARGV[6])
+	redis.call("HSET", KEYS[1], ARGV[7], ARGV[8])
+	for i = 4, #KEYS do
+		if redis.call("HGET", KEYS[i], ARGV[1]) ~= ARGV[2] then
+			redis.call("ZREM", KEYS[2], ARGV[i + 6])
+		end
+	end
+	redis.call("ZADD", KEYS[2], ARGV[9], ARGV[3])
+	return 1
+	`
+	members, err := m.userIndexMembers(ctx, userID)
+	if err != nil {
+		return
+	}
+	err = m.withUserID(ctx, key, func(oldUserID string) (changed bool, err error) {
+		oldIndexKey := m.userIndexKey(userID)
+		if oldUserID != "" {
+			oldIndexKey = m.userIndexKey(oldUserID)
+		}
+		keys := []string{key, m.userIndexKey(userID), oldIndexKey}
+		argv := []string{
+			userIDField, userID, storeKey, oldUserID,
+			userAgentField, meta.UserAgent,
+			userIPField, meta.IP,
+			strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10),
+		}
+		for _, member := range members {
+			keys = append(keys, m.getKey(member))
+			argv = append(argv, member)
+		}
+		reply, err := client.EvalWithoutNil(ctx, red.Script{
+			KEYS:   keys,
+			ARGV:   argv,
+			Script: script,
+		})
+		if err != nil {
+			return
+		}
+		intReply, err := reply.Int64()
+		if err != nil {
+			return
+		}
+		bound = intReply == 1
+		return intReply == -1, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return bound, nil
+}
+func (m RedisStore) EvictSession(ctx context.Context, storeKey string, setValues map[string]string, ttl time.Duration) (evicted bool, err error) {
+	key := m.getKey(storeKey)
+	client := m.option.Client
+	// lua 保证原子性，保留创建时间和剩余有效期，同时从用户索引中移除
+	// ARGV: userIDField, userID, storeKey, createTimeField, ttl, field1, value1, field2, value2 ...
+	// userID 与 ARGV[2] 不一致时返回 -1，由 withUserID 重试
+	script := `
+	if redis.call("EXISTS", KEYS[1]) == 0 then
+		return 0
+	end
+	local userID = redis.call("HGET", KEYS[1], ARGV[1]) or ""
+	if userID ~= ARGV[2] then
+		return -1
+	end
+	local pttl = redis.call("PTTL", KEYS[1])
+	if pttl < 0 then
+		pttl = ARGV[5]
+	end
+	local createTime = redis.call("HGET", KEYS[1], ARGV[4])
+	redis.call("DEL", KEYS[1])
+	if KEYS[2] then
+		redis.call("ZREM", KEYS[2], ARGV[3])
+	end
+	if createTime then
+		redis.call("HSET", KEYS[1], ARGV[4], createTime)
+	end
+	for i = 6, #ARGV, 2 do
+		redis.call("HSET", KEYS[1], ARGV[i], ARGV[i + 1])
+	end
+	redis.call("PEXPIRE", KEYS[1], pttl)
+	return 1
+	`
+	err = m.withUserID(ctx, key, func(userID string) (changed bool, err error) {
+		keys := []string{key}
+		if userID != "" {
+			keys = append(keys, m.userIndexKey(userID))
+		}
+		argv := []string{userIDField, userID, storeKey, createTimeField, strconv.FormatInt(ttl.Milliseconds(), 10)}
+		for _, field := range sortedFields(setValues) {
+			argv = append(argv, field, setValues[field])
+		}
+		reply, err := client.EvalWithoutNil(ctx, red.Script{
+			KEYS:   keys,
+			ARGV:   argv,
+			Script: script,
+		})
+		if err != nil {
+			return
+		}
+		intReply, err := reply.Int64()
+		if err != nil {
+			return
+		}
+		evicted = intReply == 1
+		return intReply == -1, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return evicted, nil
+}
+func (m RedisStore) UserSessions(ctx context.Context, userID string) (sessions []UserSession, err error) {
+	client := m.option.Client
+	members, err := m.userIndexMembers(ctx, userID)
+	if err != nil {
+		return
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+	// lua 保证原子性，清除用户索引中已过期的 storeKey
+	// KEYS: 用户索引, 用户索引中的 session ...
+	// ARGV: userIDField, userID, createTimeField, userAgentField, ipField, 用户索引中的 storeKey ...
+	// 返回 storeKey, 绑定时间, 创建时间, userAgent, ip 的平铺数组
+	script := `
+	local result = {}
+	for i = 2, #KEYS do
+		local storeKey = ARGV[i + 4]
+		local score = redis.call("ZSCORE", KEYS[1], storeKey)
+		if score then
+			local values = redis.call("HMGET", KEYS[i], ARGV[1], ARGV[3], ARGV[4], ARGV[5])
+			if values[1] == ARGV[2] then
+				table.insert(result, storeKey)
+				table.insert(result, score)
+				table.insert(result, values[2] or "")
+				table.insert(result, values[3] or "")
+				table.insert(result, values[4] or "")
+			else
+				redis.call("ZREM", KEYS[1], storeKey)
+			end
+		end
+	end
+	return result
+	`
+	keys := []string{m.userIndexKey(userID)}
+	argv := []string{userIDField, userID, createTimeField, userAgentField, userIPField}
+	for _, member := range members {
+		keys = append(keys, m.getKey(member))
+		argv = append(argv, member)
+	}
+	reply, err := client.EvalWithoutNil(ctx, red.Script{
+		KEYS:   keys,
+		ARGV:   argv,
+		Script: script,
+	})
+	if err != nil {
+		return
+	}
+	values, err := reply.StringSlice()
+	if err != nil {
+		return
+	}
+	for i := 0; i+4 < len(values); i += 5 {
+		session := UserSession{
+			StoreKey:  values[i].String,
+			UserAgent: values[i+3].String,
+			IP:        values[i+4].String,
+		}
+		boundAtMilli, err := strconv.ParseFloat(values[i+1].String, 64)
+		if err != nil {
+			return nil, xerr.WithStack(err)
+		}
+		session.BoundAt = time.Unix(0, int64(boundAtMilli)*int64(time.Millisecond))
+		if len(values[i+2].String) != 0 {
+			session.CreatedAt, err = parseUnixTime(values[i+2].String)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sessions = append(sessions, session)
+	}
 	return
 }
@@ -0,0 +1,319 @@
+package sess
+
+import (
+	"context"
+	xerr "github.com/goclub/error"
+	"strconv"
+	"time"
+)
+
+// RenewPolicy 续期策略，每次获取 session 时调用，通过 HubOption{}.RenewPolicy 配置
+// 不同的业务对安全性和体验的要求不同，例如银行类业务应当使用 RenewIdleTimeout，内容类业务使用默认的 RenewAtFraction
+type RenewPolicy interface {
+	Renew(info RenewInfo) (decision RenewDecision)
+}
+
+// RenewInfo 续期策略的输入
+type RenewInfo struct {
+	// store 中剩余的有效期，永不过期时为 0
+	Remaining time.Duration
+	// HubOption{}.SessionTTL
+	SessionTTL time.Duration
+	// session 创建时间
+	CreatedAt time.Time
+	// 最后一次续期时的访问时间，没有续期过时等于 CreatedAt
+	LastAccess time.Time
+	Now        time.Time
+}
+
+// RenewDecision 续期策略的输出
+type RenewDecision struct {
+	// 为 true 时将有效期设置为 TTL，此时 TTL 必须大于 0，否则获取 session 时返回错误
+	Renew bool
+	TTL   time.Duration
+	// 为 true 时删除 session 并视为过期
+	Expired bool
+}
+
+// RenewNever 从不续期，session 在创建 SessionTTL 之后过期
+type RenewNever struct{}
+
+func (RenewNever) Renew(info RenewInfo) (decision RenewDecision) {
+	return RenewDecision{}
+}
+
+// RenewAtFraction 剩余有效期小于 SessionTTL * Fraction 时将有效期设置为 SessionTTL
+// Fraction 为 0 时等同于 0.5，这也是 HubOption{}.RenewPolicy 的默认值
+// Store 实现了 StoreToucher 时只访问一次 store（配置了 AbsoluteTTL 时额外读取一次创建时间），但不会记录 RenewInfo{}.LastAccess
+type RenewAtFraction struct {
+	Fraction float64
+}
+
+func (p RenewAtFraction) threshold(sessionTTL time.Duration) time.Duration {
+	fraction := p.Fraction
+	if fraction == 0 {
+		fraction = 0.5
+	}
+	return time.Duration(float64(sessionTTL) * fraction)
+}
+func (p RenewAtFraction) Renew(info RenewInfo) (decision RenewDecision) {
+	if info.Remaining < p.threshold(info.SessionTTL) {
+		return RenewDecision{Renew: true, TTL: info.SessionTTL}
+	}
+	return RenewDecision{}
+}
+
+// RenewEvery 距离上一次续期超过 Interval 时将有效期设置为 SessionTTL
+// 例如 Interval 为 10 分钟时，活跃用户每 10 分钟最多续期一次
+type RenewEvery struct {
+	Interval time.Duration
+}
+
+func (p RenewEvery) Renew(info RenewInfo) (decision RenewDecision) {
+	if info.Now.Sub(info.LastAccess) >= p.Interval {
+		return RenewDecision{Renew: true, TTL: info.SessionTTL}
+	}
+	return RenewDecision{}
+}
+
+// RenewIdleTimeout 超过 IdleTimeout 没有访问时过期，且从创建开始超过 MaxLifetime 时过期
+// 为了避免每次请求都写入 store，剩余有效期小于 IdleTimeout 的 90% 时才续期，所以实际的空闲时间在 IdleTimeout 的 90% 到 100% 之间
+// MaxLifetime 为 0 时不限制
+type RenewIdleTimeout struct {
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+}
+
+func (p RenewIdleTimeout) Renew(info RenewInfo) (decision RenewDecision) {
+	ttl := p.IdleTimeout
+	if p.MaxLifetime > 0 {
+		remainingLifetime := info.CreatedAt.Add(p.MaxLifetime).Sub(info.Now)
+		if remainingLifetime <= 0 {
+			return RenewDecision{Expired: true}
+		}
+		if remainingLifetime < ttl {
+			ttl = remainingLifetime
+		}
+	}
+	if info.Remaining < p.IdleTimeout-p.IdleTimeout/10 {
+		return RenewDecision{Renew: true, TTL: ttl}
+	}
+	return RenewDecision{}
+}
+
+// thresholdRenewPolicy 只根据剩余有效期判断是否续期的策略
+// touch 对这类策略使用 StoreToucher 的 Touch，不需要读取 RenewInfo
+type thresholdRenewPolicy interface {
+	// renewThreshold 返回续期后的有效期，剩余有效期小于 threshold 时续期，maxLifetime 为 0 时不限制最长有效期
+	renewThreshold(sessionTTL time.Duration) (ttl time.Duration, threshold time.Duration, maxLifetime time.Duration)
+}
+
+func (RenewNever) renewThreshold(sessionTTL time.Duration) (ttl time.Duration, threshold time.Duration, maxLifetime time.Duration) {
+	return sessionTTL, 0, 0
+}
+func (p RenewAtFraction) renewThreshold(sessionTTL time.Duration) (ttl time.Duration, threshold time.Duration, maxLifetime time.Duration) {
+	return sessionTTL, p.threshold(sessionTTL), 0
+}
+func (p RenewIdleTimeout) renewThreshold(sessionTTL time.Duration) (ttl time.Duration, threshold time.Duration, maxLifetime time.Duration) {
+	return p.IdleTimeout, p.IdleTimeout - p.IdleTimeout/10, p.MaxLifetime
+}
+
+// touch 检查 storeKey 是否存在并根据 HubOption{}.RenewPolicy 实现自动续期
+// session 已被踢出时不续期，evictedReason 为踢出原因
+func (hub Hub) touch(ctx context.Context, storeKey string) (existed bool, evictedReason EvictReason, err error) {
+	if policy, ok := hub.option.RenewPolicy.(thresholdRenewPolicy); ok {
+		ttl, threshold, maxLifetime := policy.renewThreshold(hub.option.SessionTTL)
+		return hub.touchByThreshold(ctx, storeKey, ttl, threshold, maxLifetime)
+	}
+	info, existed, err := hub.renewInfo(ctx, storeKey)
+	if err != nil {
+		return
+	}
+	if existed == false {
+		return false, "", nil
+	}
+	// 自定义策略可能不续期，不会调用 RenewWithValues，需要在这里检查
+	if hub.option.MaxSessionsPerUser > 0 {
+		reason, evicted, err := hub.evictedReason(ctx, storeKey)
+		if err != nil {
+			return false, "", err
+		}
+		if evicted {
+			return true, reason, nil
+		}
+	}
+	decision := hub.option.RenewPolicy.Renew(info)
+	// TTL 不大于 0 时 store 会删除 session 或者设置为永不过期
+	if decision.Renew && decision.TTL <= 0 {
+		return false, "", xerr.New("goclub/session: RenewPolicy returned RenewDecision{Renew: true} but TTL is not greater than 0")
+	}
+	// 续期不能超过最长有效期
+	if hub.option.AbsoluteTTL > 0 {
+		remainingLifetime := info.CreatedAt.Add(hub.option.AbsoluteTTL).Sub(info.Now)
+		if remainingLifetime <= 0 {
+			decision.Expired = true
+		} else if decision.TTL > remainingLifetime {
+			decision.TTL = remainingLifetime
+		}
+	}
+	if decision.Expired {
+		err = hub.store.Destroy(ctx, storeKey)
+		if err != nil {
+			return
+		}
+		return false, "", nil
+	}
+	if decision.Renew {
+		return hub.renewWithValues(ctx, storeKey, decision.TTL, map[string]string{
+			lastAccessTimeField: strconv.FormatInt(info.Now.Unix(), 10),
+		})
+	}
+	return true, "", nil
+}
+
+// touchByThreshold 剩余有效期小于 renewThreshold 时续期，续期不会超过 AbsoluteTTL 和 maxLifetime 中较小的最长有效期
+// Store 实现了 StoreToucher 且没有最长有效期时只访问一次 store，有最长有效期时额外读取一次创建时间
+// 未实现 StoreToucher 且设置了 HubOption{}.MaxSessionsPerUser 时在续期前读取踢出原因
+func (hub Hub) touchByThreshold(ctx context.Context, storeKey string, ttl time.Duration, renewThreshold time.Duration, maxLifetime time.Duration) (existed bool, evictedReason EvictReason, err error) {
+	lifetime := hub.option.AbsoluteTTL
+	if maxLifetime > 0 && (lifetime == 0 || maxLifetime < lifetime) {
+		lifetime = maxLifetime
+	}
+	if lifetime > 0 {
+		var createdAt time.Time
+		var hasCreateTime bool
+		createdAt, hasCreateTime, err = hub.createdAt(ctx, storeKey)
+		if err != nil {
+			return
+		}
+		if hasCreateTime == false {
+			return false, "", nil
+		}
+		remainingLifetime := time.Until(createdAt.Add(lifetime))
+		if remainingLifetime <= 0 {
+			err = hub.store.Destroy(ctx, storeKey)
+			if err != nil {
+				return
+			}
+			return false, "", nil
+		}
+		if ttl > remainingLifetime {
+			ttl = remainingLifetime
+		}
+	}
+	if toucher, ok := hub.store.(StoreToucher); ok {
+		var reason string
+		existed, _, reason, err = toucher.Touch(ctx, storeKey, ttl, renewThreshold)
+		return existed, EvictReason(reason), err
+	}
+	existed, err = hub.store.StoreKeyExists(ctx, storeKey)
+	if err != nil {
+		return
+	}
+	if existed == false {
+		return false, "", nil
+	}
+	if hub.option.MaxSessionsPerUser > 0 {
+		reason, evicted, err := hub.evictedReason(ctx, storeKey)
+		if err != nil {
+			return false, "", err
+		}
+		if evicted {
+			return true, reason, nil
+		}
+	}
+	remainingTTL, err := hub.store.StoreKeyRemainingTTL(ctx, storeKey)
+	if err != nil {
+		return
+	}
+	if remainingTTL < renewThreshold {
+		// 与 redis PEXPIRE 一致，key 不存在时 RenewTTL 什么都不做
+		err = hub.store.RenewTTL(ctx, storeKey, ttl)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// renewWithValues 在 storeKey 存在时写入 setValues 并续期
+// Store 实现了 StoreToucher 时是一次原子操作，否则先续期再写入，写入后检查创建时间，
+// 如果 session 在此期间被销毁则删除写入时重新创建的 key
+func (hub Hub) renewWithValues(ctx context.Context, storeKey string, ttl time.Duration, setValues map[string]string) (existed bool, evictedReason EvictReason, err error) {
+	if toucher, ok := hub.store.(StoreToucher); ok {
+		var reason string
+		existed, reason, err = toucher.RenewWithValues(ctx, storeKey, ttl, setValues)
+		return existed, EvictReason(reason), err
+	}
+	err = hub.store.RenewTTL(ctx, storeKey, ttl)
+	if err != nil {
+		return
+	}
+	for _, field := range sortedFields(setValues) {
+		err = hub.store.Set(ctx, storeKey, field, setValues[field])
+		if err != nil {
+			return
+		}
+	}
+	_, hasCreateTime, err := hub.store.Get(ctx, storeKey, createTimeField)
+	if err != nil {
+		return
+	}
+	if hasCreateTime == false {
+		err = hub.store.Destroy(ctx, storeKey)
+		if err != nil {
+			return
+		}
+		return false, "", nil
+	}
+	return true, "", nil
+}
+
+// createdAt 读取 session 的创建时间，没有创建时间时视为 key 不存在
+func (hub Hub) createdAt(ctx context.Context, storeKey string) (createdAt time.Time, existed bool, err error) {
+	value, hasValue, err := hub.store.Get(ctx, storeKey, createTimeField)
+	if err != nil {
+		return
+	}
+	if hasValue == false {
+		return time.Time{}, false, nil
+	}
+	createdAt, err = parseUnixTime(value)
+	if err != nil {
+		return
+	}
+	return createdAt, true, nil
+}
+
+// renewInfo 读取续期策略需要的数据，没有创建时间时视为 key 不存在
+func (hub Hub) renewInfo(ctx context.Context, storeKey string) (info RenewInfo, existed bool, err error) {
+	createdAt, existed, err := hub.createdAt(ctx, storeKey)
+	if err != nil {
+		return
+	}
+	if existed == false {
+		return RenewInfo{}, false, nil
+	}
+	lastAccess := createdAt
+	value, hasValue, err := hub.store.Get(ctx, storeKey, lastAccessTimeField)
+	if err != nil {
+		return
+	}
+	if hasValue {
+		lastAccess, err = parseUnixTime(value)
+		if err != nil {
+			return
+		}
+	}
+	remaining, err := hub.store.StoreKeyRemainingTTL(ctx, storeKey)
+	if err != nil {
+		return
+	}
+	return RenewInfo{
+		Remaining:  remaining,
+		SessionTTL: hub.option.SessionTTL,
+		CreatedAt:  createdAt,
+		LastAccess: lastAccess,
+		Now:        time.Now(),
+	}, true, nil
+}
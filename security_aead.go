@@ -0,0 +1,116 @@
+package sess
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	xerr "github.com/goclub/error"
+	"io"
+)
+
+// AEADSecurity 使用认证加密(默认 AES-256-GCM)加密 storeKey
+// 与 DefaultSecurity 相比，每次加密使用 crypto/rand 生成的随机 nonce，并且解密时会校验密文是否被篡改
+// 从 DefaultSecurity 迁移时设置 Legacy: DefaultSecurity{}，旧的 sessionID 在迁移期间仍然可以解密
+type AEADSecurity struct {
+	// 创建 cipher.AEAD 的函数，为空时使用 AES-GCM
+	// 需要使用 XChaCha20-Poly1305 时可设置为 golang.org/x/crypto/chacha20poly1305.NewX
+	NewAEAD func(key []byte) (cipher.AEAD, error)
+	// 认证解密失败时使用 Legacy 解密，用于兼容迁移前生成的 sessionID
+	// 迁移完成（旧 session 全部过期）后应当移除 Legacy
+	Legacy Security
+}
+
+// ErrInvalidSessionID 表示 sessionID 认证解密失败
+var ErrInvalidSessionID = xerr.New("goclub/session: invalid sessionID, sess.HubOption{}.SecureKey is wrong or someone forged a incorrect session")
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+func (s AEADSecurity) aead(securityKey []byte) (aead cipher.AEAD, err error) {
+	newAEAD := s.NewAEAD
+	if newAEAD == nil {
+		newAEAD = newAESGCM
+	}
+	aead, err = newAEAD(securityKey)
+	if err != nil {
+		return nil, xerr.WithStack(err)
+	}
+	return
+}
+func (s AEADSecurity) Encrypt(storeKey []byte, securityKey []byte) (sessionID []byte, err error) {
+	aead, err := s.aead(securityKey)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(storeKey)+aead.Overhead())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, xerr.WithStack(err)
+	}
+	result := aead.Seal(nonce, nonce, storeKey, nil)
+	enc := base64.RawURLEncoding
+	buf := make([]byte, enc.EncodedLen(len(result)))
+	enc.Encode(buf, result)
+	return buf, nil
+}
+func (s AEADSecurity) Decrypt(sessionID []byte, securityKey []byte) (storeKey []byte, err error) {
+	storeKey, _, err = s.decryptWithLegacy(sessionID, securityKey)
+	return
+}
+
+// legacyDecrypter 解密时报告是否使用了兼容迁移的旧加密方式，Hub 会以新的加密方式重新签发 sessionID
+type legacyDecrypter interface {
+	decryptWithLegacy(sessionID []byte, securityKey []byte) (storeKey []byte, legacy bool, err error)
+}
+
+func (s AEADSecurity) decryptWithLegacy(sessionID []byte, securityKey []byte) (storeKey []byte, legacy bool, err error) {
+	storeKey, err = s.open(sessionID, securityKey)
+	if err != nil {
+		if s.Legacy != nil {
+			storeKey, err = s.Legacy.Decrypt(sessionID, securityKey)
+			if err != nil {
+				return nil, false, err
+			}
+			return storeKey, true, nil
+		}
+		return nil, false, err
+	}
+	return storeKey, false, nil
+}
+
+// decrypt 解密 sessionID，Security 实现了 legacyDecrypter 时报告是否使用了旧加密方式
+func (option HubOption) decrypt(sessionID []byte, securityKey []byte) (storeKey []byte, legacy bool, err error) {
+	if decrypter, ok := option.Security.(legacyDecrypter); ok {
+		return decrypter.decryptWithLegacy(sessionID, securityKey)
+	}
+	storeKey, err = option.Security.Decrypt(sessionID, securityKey)
+	return
+}
+func (s AEADSecurity) open(sessionID []byte, securityKey []byte) (storeKey []byte, err error) {
+	aead, err := s.aead(securityKey)
+	if err != nil {
+		return
+	}
+	enc := base64.RawURLEncoding
+	dbuf := make([]byte, enc.DecodedLen(len(sessionID)))
+	n, err := enc.Decode(dbuf, sessionID)
+	if err != nil {
+		return nil, ErrInvalidSessionID
+	}
+	dbuf = dbuf[:n]
+	if len(dbuf) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidSessionID
+	}
+	nonce := dbuf[:aead.NonceSize()]
+	ciphertext := dbuf[aead.NonceSize():]
+	storeKey, err = aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalidSessionID
+	}
+	return storeKey, nil
+}
@@ -2,30 +2,313 @@ package sess
 
 import (
 	"context"
+	xerr "github.com/goclub/error"
+	"github.com/google/uuid"
+	"sort"
+	"sync"
 	"time"
 )
 
 type Session struct {
+	hub   Hub
+	rw    SessionHttpReadWriter
+	state *sessionState
+}
+
+// sessionState 在 Session 的副本之间共享，Regenerate() 之后所有副本都会使用新的 sessionID
+type sessionState struct {
+	mu        sync.RWMutex
 	sessionID string
 	storeKey  string
-	hub       Hub
-	rw        SessionHttpReadWriter
+	// 开启 HubOption{}.LazySession 后，客户端没有 sessionID 时 store 中还没有对应的数据
+	unbacked bool
+	// 开启 HubOption{}.RequestCache 后不为 nil
+	cache *sessionCache
+}
+
+// sessionCache 请求级缓存，第一次读取时加载整个 hash，写入只记录在 dirty 和 deleted 中，Flush() 时一次性写入 store
+type sessionCache struct {
+	loaded  bool
+	values  map[string]string
+	dirty   map[string]string
+	deleted map[string]bool
+}
+
+func newSessionCache(option HubOption) *sessionCache {
+	if option.RequestCache == false {
+		return nil
+	}
+	return &sessionCache{
+		dirty:   map[string]string{},
+		deleted: map[string]bool{},
+	}
+}
+func (c *sessionCache) reset() {
+	c.loaded = false
+	c.values = nil
+	c.dirty = map[string]string{}
+	c.deleted = map[string]bool{}
 }
 
-func (s Session) existed(ctx context.Context) (existed bool, err error) {
-	return s.hub.store.StoreKeyExists(ctx, s.storeKey)
+func newSession(hub Hub, rw SessionHttpReadWriter, sessionID string, storeKey string) Session {
+	return Session{
+		hub: hub,
+		rw:  rw,
+		state: &sessionState{
+			sessionID: sessionID,
+			storeKey:  storeKey,
+			cache:     newSessionCache(hub.option),
+		},
+	}
+}
+func newUnbackedSession(hub Hub, rw SessionHttpReadWriter) Session {
+	return Session{
+		hub: hub,
+		rw:  rw,
+		state: &sessionState{
+			unbacked: true,
+			cache:    newSessionCache(hub.option),
+		},
+	}
+}
+
+// unbacked 返回 true 时表示 session 还没有在 store 中创建
+func (s Session) unbacked() bool {
+	if s.state == nil {
+		return false
+	}
+	s.state.mu.RLock()
+	defer s.state.mu.RUnlock()
+	return s.state.unbacked
+}
+
+// backed 确保 session 已经在 store 中创建，延迟创建模式下第一次写入时创建 session 并将 sessionID 写入客户端
+func (s Session) backed(ctx context.Context) (storeKey string, err error) {
+	if s.unbacked() == false {
+		return s.storeKey(), nil
+	}
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	// 加锁后再次检查，避免多个副本同时创建
+	if s.state.unbacked == false {
+		return s.state.storeKey, nil
+	}
+	sessionID, storeKey, err := s.hub.initSession(ctx)
+	if err != nil {
+		return
+	}
+	err = s.rw.Write(ctx, s.hub.option, sessionID)
+	if err != nil {
+		return
+	}
+	s.state.sessionID = sessionID
+	s.state.storeKey = storeKey
+	s.state.unbacked = false
+	return storeKey, nil
+}
+func (s Session) storeKey() (storeKey string) {
+	if s.state == nil {
+		return ""
+	}
+	s.state.mu.RLock()
+	defer s.state.mu.RUnlock()
+	return s.state.storeKey
+}
+func (s Session) setKey(sessionID string, storeKey string) {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	s.state.sessionID = sessionID
+	s.state.storeKey = storeKey
 }
 func (s Session) ID() (sessionID string) {
-	return s.sessionID
+	if s.state == nil {
+		return ""
+	}
+	s.state.mu.RLock()
+	defer s.state.mu.RUnlock()
+	return s.state.sessionID
+}
+func (s Session) cached() bool {
+	return s.state != nil && s.state.cache != nil
 }
 func (s Session) Get(ctx context.Context, field string) (value string, hasValue bool, err error) {
-	return s.hub.store.Get(ctx, s.storeKey, field)
+	if s.cached() {
+		return s.cacheGet(ctx, field)
+	}
+	if s.unbacked() {
+		return "", false, nil
+	}
+	return s.hub.store.Get(ctx, s.storeKey(), field)
+}
+func (s Session) cacheGet(ctx context.Context, field string) (value string, hasValue bool, err error) {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	cache := s.state.cache
+	if value, hasValue = cache.dirty[field]; hasValue {
+		return value, true, nil
+	}
+	if cache.deleted[field] {
+		return "", false, nil
+	}
+	if s.state.unbacked {
+		return "", false, nil
+	}
+	err = s.cacheLoad(ctx)
+	if err != nil {
+		return
+	}
+	value, hasValue = cache.values[field]
+	return
+}
+
+// cacheLoad 第一次读取时加载整个 hash，调用方需持有锁
+func (s Session) cacheLoad(ctx context.Context) (err error) {
+	cache := s.state.cache
+	if cache.loaded {
+		return nil
+	}
+	cache.values, err = s.hub.store.(BulkStore).GetAll(ctx, s.state.storeKey)
+	if err != nil {
+		return
+	}
+	cache.loaded = true
+	return
+}
+
+// getAll 读取 session 中所有的 field，开启 HubOption{}.RequestCache 时包含未 Flush 的修改
+// 需要 Store 实现 BulkStore
+func (s Session) getAll(ctx context.Context) (values map[string]string, err error) {
+	values = map[string]string{}
+	if s.cached() {
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		cache := s.state.cache
+		if s.state.unbacked == false {
+			err = s.cacheLoad(ctx)
+			if err != nil {
+				return
+			}
+		}
+		for field, value := range cache.values {
+			if cache.deleted[field] == false {
+				values[field] = value
+			}
+		}
+		for field, value := range cache.dirty {
+			values[field] = value
+		}
+		return
+	}
+	if s.unbacked() {
+		return
+	}
+	return s.hub.store.(BulkStore).GetAll(ctx, s.storeKey())
+}
+
+// bulkWrite 写入 setValues 并删除 deleteFields，Store 实现了 BulkStore 时是原子操作
+func (s Session) bulkWrite(ctx context.Context, setValues map[string]string, deleteFields []string) (err error) {
+	if s.cached() {
+		for _, field := range deleteFields {
+			err = s.Delete(ctx, field)
+			if err != nil {
+				return
+			}
+		}
+		for _, field := range sortedFields(setValues) {
+			err = s.Set(ctx, field, setValues[field])
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	if len(setValues) != 0 {
+		_, err = s.backed(ctx)
+		if err != nil {
+			return
+		}
+	}
+	if s.unbacked() {
+		return nil
+	}
+	if bulk, ok := s.hub.store.(BulkStore); ok {
+		return bulk.BulkWrite(ctx, s.storeKey(), setValues, deleteFields)
+	}
+	for _, field := range sortedFields(setValues) {
+		err = s.hub.store.Set(ctx, s.storeKey(), field, setValues[field])
+		if err != nil {
+			return
+		}
+	}
+	for _, field := range deleteFields {
+		err = s.hub.store.Delete(ctx, s.storeKey(), field)
+		if err != nil {
+			return
+		}
+	}
+	return
 }
 func (s Session) Set(ctx context.Context, field string, value string) (err error) {
-	return s.hub.store.Set(ctx, s.storeKey, field, value)
+	storeKey, err := s.backed(ctx)
+	if err != nil {
+		return
+	}
+	if s.cached() {
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		s.state.cache.dirty[field] = value
+		delete(s.state.cache.deleted, field)
+		return
+	}
+	return s.hub.store.Set(ctx, storeKey, field, value)
 }
 func (s Session) Delete(ctx context.Context, field string) (err error) {
-	return s.hub.store.Delete(ctx, s.storeKey, field)
+	if s.unbacked() {
+		return nil
+	}
+	if s.cached() {
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		s.state.cache.deleted[field] = true
+		delete(s.state.cache.dirty, field)
+		return
+	}
+	return s.hub.store.Delete(ctx, s.storeKey(), field)
+}
+
+// Flush 将 HubOption{}.RequestCache 模式下缓存的修改一次性写入 store
+// 使用 hub.Middleware() 时会在 handler 写入响应前自动调用，其他场景需要在响应前手动调用
+// 未开启 RequestCache 或没有修改时什么都不做
+func (s Session) Flush(ctx context.Context) (err error) {
+	if s.cached() == false {
+		return nil
+	}
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	cache := s.state.cache
+	if len(cache.dirty) == 0 && len(cache.deleted) == 0 {
+		return nil
+	}
+	var deleteFields []string
+	for field := range cache.deleted {
+		deleteFields = append(deleteFields, field)
+	}
+	sort.Strings(deleteFields)
+	err = s.hub.store.(BulkStore).BulkWrite(ctx, s.state.storeKey, cache.dirty, deleteFields)
+	if err != nil {
+		return
+	}
+	if cache.loaded {
+		for field, value := range cache.dirty {
+			cache.values[field] = value
+		}
+		for _, field := range deleteFields {
+			delete(cache.values, field)
+		}
+	}
+	cache.dirty = map[string]string{}
+	cache.deleted = map[string]bool{}
+	return
 }
 func (s Session) Destroy(ctx context.Context) (err error) {
 	// 如果是 cookie 场景则需要删除 cookie
@@ -33,8 +316,81 @@ func (s Session) Destroy(ctx context.Context) (err error) {
 	if err != nil {                       // indivisible end
 		return
 	}
-	return s.hub.store.Destroy(ctx, s.storeKey)
+	if s.cached() {
+		s.state.mu.Lock()
+		s.state.cache.reset()
+		s.state.mu.Unlock()
+	}
+	if s.unbacked() {
+		return nil
+	}
+	return s.hub.store.Destroy(ctx, s.storeKey())
 }
 func (s Session) SessionRemainingTTL(ctx context.Context) (ttl time.Duration, err error) {
-	return s.hub.store.StoreKeyRemainingTTL(ctx, s.storeKey)
+	if s.unbacked() {
+		return 0, nil
+	}
+	return s.hub.store.StoreKeyRemainingTTL(ctx, s.storeKey())
+}
+
+// CreatedAt 返回 session 的创建时间，未创建的 session 或 session 已过期时 has = false
+// 可用于展示登录时间，或结合 HubOption{}.AbsoluteTTL 计算剩余的最长有效期
+func (s Session) CreatedAt(ctx context.Context) (createdAt time.Time, has bool, err error) {
+	value, has, err := s.Get(ctx, createTimeField)
+	if err != nil {
+		return
+	}
+	if has == false {
+		return time.Time{}, false, nil
+	}
+	createdAt, err = parseUnixTime(value)
+	if err != nil {
+		return
+	}
+	return createdAt, true, nil
+}
+
+// Regenerate 生成新的 sessionID 并将数据移动到新的 storeKey，旧的 sessionID 随即失效
+// 在登录成功和权限变更后调用以防止会话固定攻击(session fixation)
+// 与 Destroy() 后 NewSessionID() 不同，Regenerate() 会保留 session 中的数据(例如购物车)
+// 需要 Store 实现 StoreRenamer
+func (s Session) Regenerate(ctx context.Context) (err error) {
+	// 未创建的 session 没有可以被固定的 sessionID
+	if s.unbacked() {
+		return nil
+	}
+	renamer, ok := s.hub.store.(StoreRenamer)
+	if ok == false {
+		return xerr.New("goclub/session: Session{}.Regenerate(ctx) store must implement sess.StoreRenamer")
+	}
+	oldStoreKey := s.storeKey()
+	newStoreKey := uuid.New().String()
+	renamed, err := renamer.Rename(ctx, oldStoreKey, newStoreKey)
+	if err != nil {
+		return
+	}
+	// 旧数据已过期时创建新的 session
+	if renamed == false {
+		err = s.hub.store.InitSession(ctx, newStoreKey, s.hub.option.initSessionTTL())
+		if err != nil {
+			return
+		}
+		// 缓存中加载的是已过期的数据
+		if s.cached() {
+			s.state.mu.Lock()
+			s.state.cache.loaded = false
+			s.state.cache.values = nil
+			s.state.mu.Unlock()
+		}
+	}
+	newSessionID, err := s.hub.option.encryptStoreKey(newStoreKey)
+	if err != nil {
+		return
+	}
+	err = s.rw.Write(ctx, s.hub.option, newSessionID)
+	if err != nil {
+		return
+	}
+	s.setKey(newSessionID, newStoreKey)
+	return
 }
@@ -0,0 +1,125 @@
+package sess
+
+import (
+	"context"
+	xerr "github.com/goclub/error"
+)
+
+// SessionLimitPolicy 用户的 session 数量超过 HubOption{}.MaxSessionsPerUser 时的策略
+type SessionLimitPolicy uint8
+
+const (
+	// 踢出最早绑定的 session，被踢出的 session 下一次请求时返回 *sess.SessionEvictedError
+	SessionLimitEvictOldest SessionLimitPolicy = iota
+	// 拒绝新的登录，session.BindUser() 返回 sess.ErrSessionLimitExceeded
+	SessionLimitRejectNewLogin
+)
+
+// ErrSessionLimitExceeded 使用 sess.SessionLimitRejectNewLogin 时用户的 session 数量已达到 HubOption{}.MaxSessionsPerUser
+var ErrSessionLimitExceeded = xerr.New("goclub/session: user sessions limit exceeded")
+
+// EvictReason 记录在被踢出的 session 中的原因
+type EvictReason string
+
+const (
+	// 同一用户在其他地方登录
+	EvictReasonLoggedInElsewhere EvictReason = "logged_in_elsewhere"
+)
+
+// 被踢出的 session 中记录原因的字段
+const evictedField = internalFieldPrefix + "evicted"
+
+// SessionEvictedError 表示 session 已被踢出，可以通过 sess.AsSessionEvictedError(err) 判断
+// 返回错误时已经销毁 session 并清除客户端的 sessionID，客户端下一次请求会获得新的 session
+// hub.Middleware() 未设置 OnError 时响应 401
+type SessionEvictedError struct {
+	Reason EvictReason
+}
+
+func (e *SessionEvictedError) Error() string {
+	return "goclub/session: session was evicted, reason: " + string(e.Reason)
+}
+func AsSessionEvictedError(err error) (evictedErr *SessionEvictedError, asEvictedError bool) {
+	asEvictedError = xerr.As(err, &evictedErr)
+	return
+}
+
+// checkSessionLimit 使用 SessionLimitRejectNewLogin 时检查除当前 session 外的数量
+// 注意: 同一用户并发登录时可能超过限制
+func (hub Hub) checkSessionLimit(ctx context.Context, userID string, storeKey string) (err error) {
+	if hub.option.MaxSessionsPerUser == 0 || hub.option.SessionLimitPolicy != SessionLimitRejectNewLogin {
+		return
+	}
+	sessions, err := hub.ListUserSessions(ctx, userID)
+	if err != nil {
+		return
+	}
+	var count int
+	for _, session := range sessions {
+		if session.StoreKey != storeKey {
+			count++
+		}
+	}
+	if count >= hub.option.MaxSessionsPerUser {
+		return xerr.WithStack(ErrSessionLimitExceeded)
+	}
+	return
+}
+
+// evictOldestSessions 使用 SessionLimitEvictOldest 时踢出最早绑定的 session，当前 session 不会被踢出
+func (hub Hub) evictOldestSessions(ctx context.Context, userID string, storeKey string) (err error) {
+	if hub.option.MaxSessionsPerUser == 0 || hub.option.SessionLimitPolicy != SessionLimitEvictOldest {
+		return
+	}
+	sessions, err := hub.ListUserSessions(ctx, userID)
+	if err != nil {
+		return
+	}
+	var others []UserSession
+	for _, session := range sessions {
+		if session.StoreKey != storeKey {
+			others = append(others, session)
+		}
+	}
+	// ListUserSessions 按绑定时间升序排列
+	excess := len(others) - (hub.option.MaxSessionsPerUser - 1)
+	for i := 0; i < excess; i++ {
+		err = hub.evict(ctx, others[i].StoreKey, EvictReasonLoggedInElsewhere)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// evict 原子的清除 session 的数据(同时从用户索引中移除)，只保留创建时间和踢出原因，剩余有效期不变
+func (hub Hub) evict(ctx context.Context, storeKey string, reason EvictReason) (err error) {
+	indexer := hub.store.(StoreUserIndexer)
+	_, err = indexer.EvictSession(ctx, storeKey, map[string]string{evictedField: string(reason)}, hub.option.SessionTTL)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// evictedReason 读取 session 被踢出的原因
+func (hub Hub) evictedReason(ctx context.Context, storeKey string) (reason EvictReason, evicted bool, err error) {
+	value, evicted, err := hub.store.Get(ctx, storeKey, evictedField)
+	if err != nil {
+		return
+	}
+	return EvictReason(value), evicted, nil
+}
+
+// endEvicted 销毁被踢出的 session 并清除客户端的 sessionID，返回 *SessionEvictedError
+func (hub Hub) endEvicted(ctx context.Context, storeKey string, rw SessionHttpReadWriter, reason EvictReason) (err error) {
+	err = hub.store.Destroy(ctx, storeKey)
+	if err != nil {
+		return
+	}
+	err = rw.Destroy(ctx, hub.option)
+	if err != nil {
+		return
+	}
+	return xerr.WithStack(&SessionEvictedError{Reason: reason})
+}
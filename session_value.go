@@ -0,0 +1,74 @@
+package sess
+
+import (
+	"context"
+	xerr "github.com/goclub/error"
+	"time"
+)
+
+// SetValue 使用 HubOption{}.Codec 编码 value 后写入 field
+func (s Session) SetValue(ctx context.Context, field string, value interface{}) (err error) {
+	return s.setWithCodec(ctx, s.hub.option.Codec, field, value)
+}
+
+// GetValue 读取 field 并使用 HubOption{}.Codec 解码到 ptr，解码失败时返回 *sess.DecodeError
+// 注意: 通过 session.Set() 写入的字符串不一定能被 Codec 解码
+func (s Session) GetValue(ctx context.Context, field string, ptr interface{}) (hasValue bool, err error) {
+	return s.getWithCodec(ctx, s.hub.option.Codec, field, ptr)
+}
+
+// SetJSON 使用 encoding/json 编码 value 后写入 field，不受 HubOption{}.Codec 影响
+func (s Session) SetJSON(ctx context.Context, field string, value interface{}) (err error) {
+	return s.setWithCodec(ctx, JSONCodec{}, field, value)
+}
+
+// GetJSON 读取 field 并使用 encoding/json 解码到 ptr，不受 HubOption{}.Codec 影响
+func (s Session) GetJSON(ctx context.Context, field string, ptr interface{}) (hasValue bool, err error) {
+	return s.getWithCodec(ctx, JSONCodec{}, field, ptr)
+}
+func (s Session) SetInt(ctx context.Context, field string, value int64) (err error) {
+	return s.SetValue(ctx, field, value)
+}
+func (s Session) GetInt(ctx context.Context, field string) (value int64, hasValue bool, err error) {
+	hasValue, err = s.GetValue(ctx, field, &value)
+	return
+}
+func (s Session) SetBool(ctx context.Context, field string, value bool) (err error) {
+	return s.SetValue(ctx, field, value)
+}
+func (s Session) GetBool(ctx context.Context, field string) (value bool, hasValue bool, err error) {
+	hasValue, err = s.GetValue(ctx, field, &value)
+	return
+}
+func (s Session) SetTime(ctx context.Context, field string, value time.Time) (err error) {
+	return s.SetValue(ctx, field, value)
+}
+func (s Session) GetTime(ctx context.Context, field string) (value time.Time, hasValue bool, err error) {
+	hasValue, err = s.GetValue(ctx, field, &value)
+	return
+}
+func (s Session) setWithCodec(ctx context.Context, codec Codec, field string, value interface{}) (err error) {
+	data, err := codec.Encode(value)
+	if err != nil {
+		return
+	}
+	return s.Set(ctx, field, data)
+}
+func (s Session) getWithCodec(ctx context.Context, codec Codec, field string, ptr interface{}) (hasValue bool, err error) {
+	data, hasValue, err := s.Get(ctx, field)
+	if err != nil {
+		return
+	}
+	if hasValue == false {
+		return false, nil
+	}
+	err = codec.Decode(data, ptr)
+	if err != nil {
+		return false, xerr.WithStack(&DecodeError{
+			Field: field,
+			Value: data,
+			Err:   err,
+		})
+	}
+	return true, nil
+}
@@ -0,0 +1,404 @@
+package sess
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	xerr "github.com/goclub/error"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SQLDialect 用于适配不同数据库的占位符风格和 upsert 语法
+type SQLDialect interface {
+	// Placeholder 返回第 index 个参数的占位符, index 从 1 开始
+	Placeholder(index int) string
+	// Upsert 返回追加在 INSERT INTO {table} (store_key, field, value, expires_at) VALUES (...) 之后的子句
+	// 主键 (store_key, field) 冲突时更新 value 和 expires_at，保证并发写入同一个 field 时不会主键冲突
+	Upsert() string
+}
+
+// SQLDialectMySQL 占位符为 ?
+type SQLDialectMySQL struct{}
+
+func (SQLDialectMySQL) Placeholder(index int) string { return "?" }
+func (SQLDialectMySQL) Upsert() string {
+	return ` ON DUPLICATE KEY UPDATE value = VALUES(value), expires_at = VALUES(expires_at)`
+}
+
+// SQLDialectPostgreSQL 占位符为 $1 $2 ...
+type SQLDialectPostgreSQL struct{}
+
+func (SQLDialectPostgreSQL) Placeholder(index int) string { return "$" + strconv.Itoa(index) }
+func (SQLDialectPostgreSQL) Upsert() string {
+	return ` ON CONFLICT (store_key, field) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at`
+}
+
+// SQLDialectSQLite 占位符为 ?，upsert 需要 SQLite 3.24.0 及以上版本
+type SQLDialectSQLite struct{}
+
+func (SQLDialectSQLite) Placeholder(index int) string { return "?" }
+func (SQLDialectSQLite) Upsert() string {
+	return ` ON CONFLICT (store_key, field) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`
+}
+
+// NewSQLStore 创建基于 database/sql 的 Store，需要先根据以下结构创建数据表(表名可通过 SQLStoreOption{}.Table 配置)
+//
+//	CREATE TABLE goclub_session (
+//	    store_key  VARCHAR(64)  NOT NULL,
+//	    field      VARCHAR(255) NOT NULL,
+//	    value      TEXT         NOT NULL,
+//	    expires_at BIGINT       NOT NULL,
+//	    PRIMARY KEY (store_key, field)
+//	);
+//	CREATE INDEX idx_goclub_session_expires_at ON goclub_session (expires_at);
+//
+// 以上为 PostgreSQL 和 SQLite 的建表语句，两者的 TEXT 没有长度限制。
+// MySQL 的 TEXT 最多保存 64KB，超出时会被截断或报错，value 需要使用 MEDIUMTEXT(16MB):
+//
+//	CREATE TABLE goclub_session (
+//	    store_key  VARCHAR(64)  NOT NULL,
+//	    field      VARCHAR(255) NOT NULL,
+//	    value      MEDIUMTEXT   NOT NULL,
+//	    expires_at BIGINT       NOT NULL,
+//	    PRIMARY KEY (store_key, field)
+//	);
+//	CREATE INDEX idx_goclub_session_expires_at ON goclub_session (expires_at);
+//
+// 一个 session 对应多行数据，每行是 hash 中的一个 field。
+// expires_at 为 unix 毫秒时间戳，0 表示永不过期（与 redis 中 HSET 一个不存在的 key 的行为一致）
+// 过期的行在读取时会被忽略，并由后台 goroutine 每隔 SQLStoreOption{}.SweepInterval 删除，不再使用时调用 Close() 停止
+// SQLStore 没有实现 StoreAppender: 各数据库缺少可移植的原子追加写法，
+// session.AddFlash() 会依次调用 Get 和 Set，多个请求同时添加同一类型的 flash 时可能丢失消息
+func NewSQLStore(option SQLStoreOption) (store *SQLStore, err error) {
+	if option.DB == nil {
+		return nil, xerr.New("goclub/session: NewSQLStore(option) option.DB can not be nil")
+	}
+	if option.Table == "" {
+		option.Table = "goclub_session"
+	}
+	if sqlTableNameRegexp.MatchString(option.Table) == false {
+		return nil, xerr.New("goclub/session: NewSQLStore(option) option.Table is invalid table name: " + option.Table)
+	}
+	if option.Dialect == nil {
+		option.Dialect = SQLDialectMySQL{}
+	}
+	if option.SweepInterval == 0 {
+		option.SweepInterval = time.Minute
+	}
+	store = &SQLStore{
+		option: option,
+		done:   make(chan struct{}),
+	}
+	if option.SweepInterval > 0 {
+		go store.sweeper(option.SweepInterval)
+	}
+	return store, nil
+}
+
+var sqlTableNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.]*$`)
+
+type SQLStoreOption struct {
+	DB *sql.DB
+	// 表名, 默认为 goclub_session
+	Table string
+	// 占位符风格, 默认为 SQLDialectMySQL{}
+	Dialect SQLDialect
+	// 删除过期数据的间隔, 默认为 1 分钟, 小于 0 时不启动后台删除
+	SweepInterval time.Duration
+	// 后台删除过期数据失败时触发, 用于监控
+	OnSweepError func(err error)
+}
+type SQLStore struct {
+	option    SQLStoreOption
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Close 停止后台删除过期数据的 goroutine，不会关闭 SQLStoreOption{}.DB，可重复调用
+func (m *SQLStore) Close() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+}
+func (m *SQLStore) sweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			err := m.DeleteExpired(context.Background())
+			if err != nil && m.option.OnSweepError != nil {
+				m.option.OnSweepError(err)
+			}
+		}
+	}
+}
+
+// DeleteExpired 删除所有过期的数据，一般情况下不需要手动调用
+func (m *SQLStore) DeleteExpired(ctx context.Context) (err error) {
+	_, err = m.option.DB.ExecContext(ctx, m.query(`DELETE FROM {table} WHERE expires_at <> 0 AND expires_at <= ?`), nowUnixMilli())
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	return
+}
+
+// query 将 {table} 替换为表名，将 ? 替换为 dialect 的占位符
+func (m *SQLStore) query(query string) string {
+	query = strings.Replace(query, "{table}", m.option.Table, -1)
+	var builder strings.Builder
+	index := 0
+	for _, r := range query {
+		if r == '?' {
+			index++
+			builder.WriteString(m.option.Dialect.Placeholder(index))
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// sqlAlive 用于过滤未过期的行，需要传入当前 unix 毫秒时间戳作为参数
+const sqlAlive = `(expires_at = 0 OR expires_at > ?)`
+
+func nowUnixMilli() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+func expiresAtFromTTL(ttl time.Duration) int64 {
+	return nowUnixMilli() + ttl.Milliseconds()
+}
+
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (m *SQLStore) tx(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := m.option.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	err = fn(tx)
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			return xerr.WrapPrefix("goclub/session: SQLStore rollback fail: "+rollbackErr.Error(), err)
+		}
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	return
+}
+
+// deleteExpiredKey 删除 storeKey 已过期的行，避免过期数据与新数据混在一起
+func (m *SQLStore) deleteExpiredKey(ctx context.Context, db sqlExecer, storeKey string) (err error) {
+	_, err = db.ExecContext(ctx, m.query(`DELETE FROM {table} WHERE store_key = ? AND expires_at <> 0 AND expires_at <= ?`), storeKey, nowUnixMilli())
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	return
+}
+
+// keyExpiresAt 查询 storeKey 的过期时间, 同一个 storeKey 的所有行 expires_at 相同
+func (m *SQLStore) keyExpiresAt(ctx context.Context, db sqlExecer, storeKey string) (expiresAt int64, existed bool, err error) {
+	var value sql.NullInt64
+	err = db.QueryRowContext(ctx, m.query(`SELECT MAX(expires_at) FROM {table} WHERE store_key = ? AND `+sqlAlive), storeKey, nowUnixMilli()).Scan(&value)
+	if err != nil {
+		return 0, false, xerr.WithStack(err)
+	}
+	return value.Int64, value.Valid, nil
+}
+
+// setField 使用 dialect 的 upsert 写入一个 field，一条语句完成避免并发写入时主键冲突
+func (m *SQLStore) setField(ctx context.Context, db sqlExecer, storeKey string, field string, value string, expiresAt int64) (err error) {
+	_, err = db.ExecContext(ctx, m.query(`INSERT INTO {table} (store_key, field, value, expires_at) VALUES (?, ?, ?, ?)`+m.option.Dialect.Upsert()), storeKey, field, value, expiresAt)
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	return
+}
+func (m *SQLStore) InitSession(ctx context.Context, storeKey string, sessionTTL time.Duration) (err error) {
+	// 与 RedisStore 一致: 写入 __goclub_session_create_time 并设置整个 hash 的过期时间
+	return m.tx(ctx, func(tx *sql.Tx) error {
+		err := m.deleteExpiredKey(ctx, tx, storeKey)
+		if err != nil {
+			return err
+		}
+		expiresAt := expiresAtFromTTL(sessionTTL)
+		_, err = tx.ExecContext(ctx, m.query(`UPDATE {table} SET expires_at = ? WHERE store_key = ?`), expiresAt, storeKey)
+		if err != nil {
+			return xerr.WithStack(err)
+		}
+		return m.setField(ctx, tx, storeKey, createTimeField, strconv.FormatInt(time.Now().Unix(), 10), expiresAt)
+	})
+}
+func (m *SQLStore) StoreKeyExists(ctx context.Context, storeKey string) (existed bool, err error) {
+	_, existed, err = m.keyExpiresAt(ctx, m.option.DB, storeKey)
+	return
+}
+func (m *SQLStore) StoreKeyRemainingTTL(ctx context.Context, storeKey string) (remainingTTL time.Duration, err error) {
+	expiresAt, existed, err := m.keyExpiresAt(ctx, m.option.DB, storeKey)
+	if err != nil {
+		return
+	}
+	// 与 RedisStore 一致: key 不存在或永不过期时返回 0
+	if existed == false || expiresAt == 0 {
+		return 0, nil
+	}
+	return time.Duration(expiresAt-nowUnixMilli()) * time.Millisecond, nil
+}
+func (m *SQLStore) RenewTTL(ctx context.Context, storeKey string, ttl time.Duration) (err error) {
+	now := nowUnixMilli()
+	_, err = m.option.DB.ExecContext(ctx, m.query(`UPDATE {table} SET expires_at = ? WHERE store_key = ? AND `+sqlAlive), now+ttl.Milliseconds(), storeKey, now)
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	return
+}
+func (m *SQLStore) Get(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error) {
+	err = m.option.DB.QueryRowContext(ctx, m.query(`SELECT value FROM {table} WHERE store_key = ? AND field = ? AND `+sqlAlive), storeKey, field, nowUnixMilli()).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, xerr.WithStack(err)
+	}
+	return value, true, nil
+}
+func (m *SQLStore) Set(ctx context.Context, storeKey string, field string, value string) (err error) {
+	return m.tx(ctx, func(tx *sql.Tx) error {
+		err := m.deleteExpiredKey(ctx, tx, storeKey)
+		if err != nil {
+			return err
+		}
+		// 新的 field 沿用 hash 的过期时间, hash 不存在时与 redis HSET 一致创建永不过期的数据
+		expiresAt, _, err := m.keyExpiresAt(ctx, tx, storeKey)
+		if err != nil {
+			return err
+		}
+		return m.setField(ctx, tx, storeKey, field, value, expiresAt)
+	})
+}
+func (m *SQLStore) Delete(ctx context.Context, storeKey string, field string) (err error) {
+	_, err = m.option.DB.ExecContext(ctx, m.query(`DELETE FROM {table} WHERE store_key = ? AND field = ?`), storeKey, field)
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	return
+}
+func (m *SQLStore) Destroy(ctx context.Context, storeKey string) (err error) {
+	_, err = m.option.DB.ExecContext(ctx, m.query(`DELETE FROM {table} WHERE store_key = ?`), storeKey)
+	if err != nil {
+		return xerr.WithStack(err)
+	}
+	return
+}
+func (m *SQLStore) Rename(ctx context.Context, oldStoreKey string, newStoreKey string) (renamed bool, err error) {
+	err = m.tx(ctx, func(tx *sql.Tx) error {
+		err := m.deleteExpiredKey(ctx, tx, oldStoreKey)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, m.query(`DELETE FROM {table} WHERE store_key = ?`), newStoreKey)
+		if err != nil {
+			return xerr.WithStack(err)
+		}
+		result, err := tx.ExecContext(ctx, m.query(`UPDATE {table} SET store_key = ? WHERE store_key = ?`), newStoreKey, oldStoreKey)
+		if err != nil {
+			return xerr.WithStack(err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return xerr.WithStack(err)
+		}
+		renamed = affected != 0
+		return nil
+	})
+	return
+}
+func (m *SQLStore) GetAll(ctx context.Context, storeKey string) (values map[string]string, err error) {
+	rows, err := m.option.DB.QueryContext(ctx, m.query(`SELECT field, value FROM {table} WHERE store_key = ? AND `+sqlAlive), storeKey, nowUnixMilli())
+	if err != nil {
+		return nil, xerr.WithStack(err)
+	}
+	defer rows.Close()
+	values = map[string]string{}
+	for rows.Next() {
+		var field, value string
+		err = rows.Scan(&field, &value)
+		if err != nil {
+			return nil, xerr.WithStack(err)
+		}
+		values[field] = value
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, xerr.WithStack(err)
+	}
+	return
+}
+func (m *SQLStore) BulkWrite(ctx context.Context, storeKey string, setValues map[string]string, deleteFields []string) (err error) {
+	if len(setValues) == 0 && len(deleteFields) == 0 {
+		return
+	}
+	return m.tx(ctx, func(tx *sql.Tx) error {
+		err := m.deleteExpiredKey(ctx, tx, storeKey)
+		if err != nil {
+			return err
+		}
+		expiresAt, _, err := m.keyExpiresAt(ctx, tx, storeKey)
+		if err != nil {
+			return err
+		}
+		for _, field := range sortedFields(setValues) {
+			err = m.setField(ctx, tx, storeKey, field, setValues[field], expiresAt)
+			if err != nil {
+				return err
+			}
+		}
+		for _, field := range deleteFields {
+			_, err = tx.ExecContext(ctx, m.query(`DELETE FROM {table} WHERE store_key = ? AND field = ?`), storeKey, field)
+			if err != nil {
+				return xerr.WithStack(err)
+			}
+		}
+		return nil
+	})
+}
+
+const sqlGetDeleteMaxRetry = 10
+
+func (m *SQLStore) GetDelete(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error) {
+	// 删除时比较 value，并发的 GetDelete 只有一个能删除成功，value 被并发修改时重试
+	for i := 0; i < sqlGetDeleteMaxRetry; i++ {
+		value, hasValue, err = m.Get(ctx, storeKey, field)
+		if err != nil {
+			return
+		}
+		if hasValue == false {
+			return "", false, nil
+		}
+		result, err := m.option.DB.ExecContext(ctx, m.query(`DELETE FROM {table} WHERE store_key = ? AND field = ? AND value = ?`), storeKey, field, value)
+		if err != nil {
+			return "", false, xerr.WithStack(err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return "", false, xerr.WithStack(err)
+		}
+		if affected != 0 {
+			return value, true, nil
+		}
+	}
+	return "", false, xerr.New("goclub/session: SQLStore GetDelete retry too many times, storeKey: " + storeKey + " field: " + field)
+}
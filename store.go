@@ -2,11 +2,14 @@ package sess
 
 import (
 	"context"
+	"encoding/json"
+	xerr "github.com/goclub/error"
+	"sort"
 	"time"
 )
 
 // 满足 Store 接口的结构体可作为 goclub/sessoin 的数据层
-// 已经封装好的有 sess.NewRedisStore()
+// 已经封装好的有 sess.NewRedisStore() sess.NewMemoryStore() sess.NewSQLStore() sess.NewFileStore()
 type Store interface {
 	InitSession(ctx context.Context, storeKey string, sessionTTL time.Duration) (err error)
 	StoreKeyExists(ctx context.Context, storeKey string) (existed bool, err error)
@@ -17,3 +20,108 @@ type Store interface {
 	Delete(ctx context.Context, storeKey string, field string) (err error)
 	Destroy(ctx context.Context, storeKey string) (err error)
 }
+
+// StoreRenamer 是 Store 的可选能力，Session{}.Regenerate() 需要 Store 实现 StoreRenamer
+type StoreRenamer interface {
+	// Rename 原子的将 oldStoreKey 的所有 field 和 ttl 移动到 newStoreKey 并删除 oldStoreKey
+	// oldStoreKey 不存在时 renamed = false
+	Rename(ctx context.Context, oldStoreKey string, newStoreKey string) (renamed bool, err error)
+}
+
+// BulkStore 是 Store 的可选能力，HubOption{}.RequestCache 需要 Store 实现 BulkStore
+type BulkStore interface {
+	// GetAll 返回 hash 中所有的 field，key 不存在时返回空 map
+	GetAll(ctx context.Context, storeKey string) (values map[string]string, err error)
+	// BulkWrite 原子的写入 setValues 并删除 deleteFields
+	BulkWrite(ctx context.Context, storeKey string, setValues map[string]string, deleteFields []string) (err error)
+}
+
+// StoreToucher 是 Store 的可选能力，实现后 Hub 获取 session 时只需要访问一次 store
+// 未实现时 Hub 会依次调用 StoreKeyExists StoreKeyRemainingTTL RenewTTL
+// 两个方法都需要在 hash 中存在 __goclub_session_evicted 字段（session 已被踢出）时不做任何修改并通过 evictedReason 返回该字段的值，
+// 这样 HubOption{}.MaxSessionsPerUser 检查 session 是否被踢出时不需要额外访问 store，也不会续期被踢出的 session
+type StoreToucher interface {
+	// Touch 原子的检查 storeKey 是否存在，并在剩余有效期小于 renewThreshold 时将有效期设置为 ttl
+	// remaining 为续期前的剩余有效期，与 StoreKeyRemainingTTL 一致: key 不存在或永不过期时为 0
+	Touch(ctx context.Context, storeKey string, ttl time.Duration, renewThreshold time.Duration) (existed bool, remaining time.Duration, evictedReason string, err error)
+	// RenewWithValues 原子的检查 storeKey 是否存在，存在时写入 setValues 并将有效期设置为 ttl，不存在时不做任何修改
+	// 续期时使用它记录访问时间，避免 session 在读取和写入之间被销毁后 Set 重新创建 key
+	RenewWithValues(ctx context.Context, storeKey string, ttl time.Duration, setValues map[string]string) (existed bool, evictedReason string, err error)
+}
+
+// StoreGetDeleter 是 Store 的可选能力，session.Flashes() 使用它保证多个请求同时读取时 flash 只会被读取一次
+// 未实现时 session.Flashes() 会依次调用 Get 和 Delete
+type StoreGetDeleter interface {
+	// GetDelete 原子的读取并删除 field
+	GetDelete(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error)
+}
+
+// StoreAppender 是 Store 的可选能力，session.AddFlash() 使用它保证多个请求同时添加 flash 时消息不会丢失
+// 未实现时 session.AddFlash() 会依次调用 Get 和 Set，并发添加同一类型的 flash 时可能丢失消息
+type StoreAppender interface {
+	// AppendJSONArray 原子的将已编码为 json 的 element 追加到 field 中保存的 json 数组末尾
+	// field 不存在时写入只包含 element 的数组，与 Set 一致: key 不存在时创建 key
+	AppendJSONArray(ctx context.Context, storeKey string, field string, element string) (err error)
+}
+
+// StoreUserIndexer 是 Store 的可选能力，维护 userID 到 storeKey 的索引，用于列出和注销用户的所有 session(设备管理)
+// session.BindUser() sessHub.ListUserSessions() sessHub.DestroyUserSessions() 需要 Store 实现 StoreUserIndexer
+// 实现者需要保证 Destroy 和 Rename 时同时更新索引
+type StoreUserIndexer interface {
+	// BindUser 原子的在 session 中写入 userID 字段(__goclub_session_user_id)和 meta 并加入用户的索引
+	// 已绑定其他用户时从旧用户的索引中移除，storeKey 不存在时 bound = false
+	BindUser(ctx context.Context, storeKey string, userID string, meta UserSessionMeta) (bound bool, err error)
+	// UserSessions 返回用户未过期的 session，按绑定时间升序排列，同时清除索引中已过期的 storeKey
+	UserSessions(ctx context.Context, userID string) (sessions []UserSession, err error)
+	// EvictSession 原子的删除 session 中除创建时间(__goclub_session_create_time)外的字段并从用户索引中移除，然后写入 setValues
+	// 剩余有效期不变，永不过期的 key 有效期设置为 ttl，storeKey 不存在时不做任何修改并返回 evicted = false
+	// HubOption{}.MaxSessionsPerUser 踢出 session 时使用，避免在删除和写入之间到达的请求获得新的 session
+	EvictSession(ctx context.Context, storeKey string, setValues map[string]string, ttl time.Duration) (evicted bool, err error)
+}
+
+// goclub/session 内部使用的字段前缀
+const internalFieldPrefix = "__goclub_session_"
+
+// InitSession 时写入的字段，值为 session 创建时的 unix 时间戳（秒）
+// 实现 Store 时应当在 InitSession 中写入此字段以保证 key 存在
+const createTimeField = internalFieldPrefix + "create_time"
+
+// 续期时写入的字段，记录最后一次续期时的访问时间
+const lastAccessTimeField = internalFieldPrefix + "last_access_time"
+
+// session.BindUser() 时写入的字段
+const (
+	userIDField    = internalFieldPrefix + "user_id"
+	userAgentField = internalFieldPrefix + "user_agent"
+	userIPField    = internalFieldPrefix + "user_ip"
+)
+
+// sortedFields 返回排序后的 field，保证批量写入的顺序是确定的
+func sortedFields(values map[string]string) (fields []string) {
+	for field := range values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return
+}
+
+// appendJSONArray 将已编码为 json 的 element 追加到 value 保存的 json 数组末尾，hasValue 为 false 时返回只包含 element 的数组
+func appendJSONArray(field string, value string, hasValue bool, element string) (result string, err error) {
+	var elements []json.RawMessage
+	if hasValue {
+		err = json.Unmarshal([]byte(value), &elements)
+		if err != nil {
+			return "", xerr.WithStack(&DecodeError{
+				Field: field,
+				Value: value,
+				Err:   err,
+			})
+		}
+	}
+	elements = append(elements, json.RawMessage(element))
+	data, err := json.Marshal(elements)
+	if err != nil {
+		return "", xerr.WithStack(err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,67 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAbsoluteTTL(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:   testSecureKey,
+		SessionTTL:  time.Hour * 8,
+		AbsoluteTTL: time.Hour,
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	storeKey := mustStoreKey(t, sessionID)
+	// 创建 session 时有效期不超过 AbsoluteTTL
+	{
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, int64(ttl), int64(time.Hour))
+	}
+	{
+		session, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		assert.Equal(t, sessionExpired, false)
+		createdAt, has, err := session.CreatedAt(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.WithinDuration(t, createdAt, time.Now(), time.Second*2)
+	}
+	// 续期不超过最长有效期
+	{
+		setCreateTime(t, store, storeKey, time.Now().Add(-time.Minute*50))
+		assert.NoError(t, store.RenewTTL(ctx, storeKey, time.Minute))
+		_, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		assert.Equal(t, sessionExpired, false)
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, int64(ttl), int64(time.Minute*10))
+		assert.Greater(t, int64(ttl), int64(time.Minute*8))
+	}
+	// 超过最长有效期视为过期
+	{
+		setCreateTime(t, store, storeKey, time.Now().Add(-time.Hour*2))
+		_, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		assert.Equal(t, sessionExpired, true)
+		existed, err := store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+	}
+}
+
+func setCreateTime(t *testing.T, store sess.Store, storeKey string, createdAt time.Time) {
+	err := store.Set(context.Background(), storeKey, "__goclub_session_create_time", strconv.FormatInt(createdAt.Unix(), 10))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,143 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type bindLogin struct {
+	UserID    string    `sess:"user_id"`
+	Age       int       `sess:"age"`
+	Admin     bool      `sess:"admin"`
+	LoginTime time.Time `sess:"login_time"`
+	Nickname  string    `sess:"nickname,omitempty"`
+	Ignore    string
+}
+
+func TestSessionLoadSave(t *testing.T) {
+	ctx := context.Background()
+	store := &bulkCountStore{MemoryStore: sess.NewMemoryStore()}
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	session, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+	assert.NoError(t, err)
+	loginTime := time.Unix(1600000000, 0).UTC()
+	assert.NoError(t, session.Set(ctx, "nickname", "nimo"))
+	assert.NoError(t, session.Save(ctx, bindLogin{
+		UserID:    "1",
+		Age:       18,
+		Admin:     true,
+		LoginTime: loginTime,
+		Ignore:    "ignore",
+	}))
+	// 一次写入
+	assert.Equal(t, atomic.LoadInt64(&store.bulkWrite), int64(1))
+	{
+		value, has, err := session.Get(ctx, "user_id")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, value, "1")
+		// omitempty 零值删除 field
+		_, has, err = session.Get(ctx, "nickname")
+		assert.NoError(t, err)
+		assert.Equal(t, has, false)
+		_, has, err = session.Get(ctx, "Ignore")
+		assert.NoError(t, err)
+		assert.Equal(t, has, false)
+	}
+	var login bindLogin
+	assert.NoError(t, session.Load(ctx, &login))
+	// 一次读取
+	assert.Equal(t, atomic.LoadInt64(&store.getAll), int64(1))
+	assert.Equal(t, login, bindLogin{
+		UserID:    "1",
+		Age:       18,
+		Admin:     true,
+		LoginTime: loginTime,
+	})
+}
+
+func TestSessionLoadError(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	session, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+	assert.NoError(t, err)
+	assert.NoError(t, session.Set(ctx, "user_id", "1"))
+	assert.NoError(t, session.Set(ctx, "age", "eighteen"))
+	assert.NoError(t, session.Set(ctx, "cart", "[1,2]"))
+	{
+		var login bindLogin
+		err := session.Load(ctx, &login)
+		bindErr, asBindError := sess.AsBindError(err)
+		assert.Equal(t, asBindError, true)
+		// 默认忽略未知字段
+		assert.Equal(t, len(bindErr.UnknownFields), 0)
+		assert.Equal(t, len(bindErr.FieldErrors), 1)
+		assert.Equal(t, bindErr.FieldErrors[0].StructField, "Age")
+		assert.Equal(t, bindErr.FieldErrors[0].Field, "age")
+		// 其他字段仍会被赋值
+		assert.Equal(t, login.UserID, "1")
+	}
+	// 开启 StrictLoad 时返回未知字段
+	{
+		strictHub, err := sess.NewHub(store, sess.HubOption{
+			SecureKey:  testSecureKey,
+			StrictLoad: true,
+		})
+		assert.NoError(t, err)
+		strictSession, _, err := strictHub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		var login struct {
+			UserID string `sess:"user_id"`
+			Age    string `sess:"age"`
+		}
+		err = strictSession.Load(ctx, &login)
+		bindErr, asBindError := sess.AsBindError(err)
+		assert.Equal(t, asBindError, true)
+		assert.Equal(t, bindErr.UnknownFields, []string{"cart"})
+		assert.Equal(t, len(bindErr.FieldErrors), 0)
+		assert.Equal(t, login.UserID, "1")
+	}
+	// 没有类型错误时忽略未知字段
+	{
+		var login struct {
+			UserID string `sess:"user_id"`
+		}
+		assert.NoError(t, session.Load(ctx, &login))
+		assert.Equal(t, login.UserID, "1")
+	}
+	// sess:",remain" 接收未知字段
+	{
+		var login struct {
+			UserID string            `sess:"user_id"`
+			Extra  map[string]string `sess:",remain"`
+		}
+		assert.NoError(t, session.Load(ctx, &login))
+		assert.Equal(t, login.UserID, "1")
+		assert.Equal(t, login.Extra, map[string]string{"age": "eighteen", "cart": "[1,2]"})
+	}
+	{
+		var login struct {
+			UserID string `sess:"user_id"`
+			ID     string `sess:"user_id"`
+		}
+		assert.Error(t, session.Load(ctx, &login))
+		assert.Error(t, session.Load(ctx, login))
+	}
+}
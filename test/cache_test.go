@@ -0,0 +1,214 @@
+package testSess
+
+import (
+	"context"
+	"errors"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// bulkCountStore 记录 GetAll 和 BulkWrite 被调用的次数
+type bulkCountStore struct {
+	*sess.MemoryStore
+	getAll    int64
+	bulkWrite int64
+}
+
+func (s *bulkCountStore) GetAll(ctx context.Context, storeKey string) (values map[string]string, err error) {
+	atomic.AddInt64(&s.getAll, 1)
+	return s.MemoryStore.GetAll(ctx, storeKey)
+}
+func (s *bulkCountStore) BulkWrite(ctx context.Context, storeKey string, setValues map[string]string, deleteFields []string) (err error) {
+	atomic.AddInt64(&s.bulkWrite, 1)
+	return s.MemoryStore.BulkWrite(ctx, storeKey, setValues, deleteFields)
+}
+
+func TestRequestCache(t *testing.T) {
+	ctx := context.Background()
+	store := &bulkCountStore{MemoryStore: sess.NewMemoryStore()}
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:    testSecureKey,
+		RequestCache: true,
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	storeKey := mustStoreKey(t, sessionID)
+	assert.NoError(t, store.Set(ctx, storeKey, "name", "nimo"))
+	assert.NoError(t, store.Set(ctx, storeKey, "age", "18"))
+
+	session, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		value, has, err := session.Get(ctx, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, value, "nimo")
+	}
+	// 多次读取只加载一次
+	assert.Equal(t, atomic.LoadInt64(&store.getAll), int64(1))
+
+	assert.NoError(t, session.Set(ctx, "name", "tim"))
+	assert.NoError(t, session.Delete(ctx, "age"))
+	// 读取到未写入的修改
+	{
+		value, has, err := session.Get(ctx, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, value, "tim")
+		_, has, err = session.Get(ctx, "age")
+		assert.NoError(t, err)
+		assert.Equal(t, has, false)
+	}
+	// Flush 前 store 中的数据不变
+	{
+		value, _, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "nimo")
+	}
+	assert.NoError(t, session.Flush(ctx))
+	assert.Equal(t, atomic.LoadInt64(&store.bulkWrite), int64(1))
+	{
+		value, _, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "tim")
+		_, has, err := store.Get(ctx, storeKey, "age")
+		assert.NoError(t, err)
+		assert.Equal(t, has, false)
+	}
+	// 没有修改时 Flush 不访问 store
+	assert.NoError(t, session.Flush(ctx))
+	assert.Equal(t, atomic.LoadInt64(&store.bulkWrite), int64(1))
+}
+
+func TestRequestCacheMiddleware(t *testing.T) {
+	store := &bulkCountStore{MemoryStore: sess.NewMemoryStore()}
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:    testSecureKey,
+		RequestCache: true,
+	})
+	assert.NoError(t, err)
+	handler := hub.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		session, _ := sess.FromContext(request.Context())
+		assert.NoError(t, session.Set(request.Context(), "name", "nimo"))
+		assert.NoError(t, session.Set(request.Context(), "age", "18"))
+	}))
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, atomic.LoadInt64(&store.bulkWrite), int64(1))
+	session, err := hub.GetSessionByCookie(context.Background(), httptest.NewRecorder(), requestWithCookie(writer))
+	assert.NoError(t, err)
+	value, has, err := session.Get(context.Background(), "age")
+	assert.NoError(t, err)
+	assert.Equal(t, has, true)
+	assert.Equal(t, value, "18")
+}
+
+// TestRequestCacheMiddlewareFlushBeforeWrite handler 写入响应前已经写入 store，客户端收到重定向后的请求可以读取到修改
+func TestRequestCacheMiddlewareFlushBeforeWrite(t *testing.T) {
+	store := &bulkCountStore{MemoryStore: sess.NewMemoryStore()}
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:    testSecureKey,
+		RequestCache: true,
+	})
+	assert.NoError(t, err)
+	// 不使用 RequestCache 的 hub 直接读取 store
+	plainHub, err := sess.NewHub(store.MemoryStore, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	writer := httptest.NewRecorder()
+	handler := hub.Middleware(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+		session, _ := sess.FromContext(ctx)
+		assert.NoError(t, session.Set(ctx, "name", "nimo"))
+		http.Redirect(w, request, "/home", http.StatusFound)
+		assert.Equal(t, atomic.LoadInt64(&store.bulkWrite), int64(1))
+		stored, err := plainHub.GetSessionByCookie(ctx, httptest.NewRecorder(), requestWithCookie(writer))
+		assert.NoError(t, err)
+		value, has, err := stored.Get(ctx, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, value, "nimo")
+	}))
+	handler.ServeHTTP(writer, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, writer.Code, http.StatusFound)
+	assert.Equal(t, atomic.LoadInt64(&store.bulkWrite), int64(1))
+}
+
+// failBulkWriteStore BulkWrite 总是失败
+type failBulkWriteStore struct {
+	*sess.MemoryStore
+}
+
+func (s failBulkWriteStore) BulkWrite(ctx context.Context, storeKey string, setValues map[string]string, deleteFields []string) (err error) {
+	return errors.New("bulk write")
+}
+
+// TestRequestCacheMiddlewareFlushError Flush 失败时还没有写入响应，OnError 可以响应错误，handler 的写入返回错误
+func TestRequestCacheMiddlewareFlushError(t *testing.T) {
+	store := failBulkWriteStore{MemoryStore: sess.NewMemoryStore()}
+	defer store.Close()
+	var onError int
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:    testSecureKey,
+		RequestCache: true,
+		Middleware: sess.HubOptionMiddleware{
+			OnError: func(writer http.ResponseWriter, request *http.Request, err error) {
+				onError++
+				assert.EqualError(t, err, "bulk write")
+				writer.WriteHeader(http.StatusServiceUnavailable)
+			},
+		},
+	})
+	assert.NoError(t, err)
+	handler := hub.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+		session, _ := sess.FromContext(ctx)
+		assert.NoError(t, session.Set(ctx, "name", "nimo"))
+		writer.WriteHeader(http.StatusOK)
+		_, err := writer.Write([]byte("ok"))
+		assert.EqualError(t, err, "bulk write")
+	}))
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, onError, 1)
+	assert.Equal(t, writer.Code, http.StatusServiceUnavailable)
+	assert.Equal(t, writer.Body.String(), "")
+	// handler 没有写入响应时在 handler 执行后 Flush
+	onError = 0
+	handler = hub.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+		session, _ := sess.FromContext(ctx)
+		assert.NoError(t, session.Set(ctx, "name", "nimo"))
+	}))
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, onError, 1)
+	assert.Equal(t, writer.Code, http.StatusServiceUnavailable)
+}
+
+func TestRequestCacheRequireBulkStore(t *testing.T) {
+	_, err := sess.NewHub(sess.RedisStore{}, sess.HubOption{
+		SecureKey:    testSecureKey,
+		RequestCache: true,
+	})
+	assert.NoError(t, err)
+	_, err = sess.NewHub(plainStore{}, sess.HubOption{
+		SecureKey:    testSecureKey,
+		RequestCache: true,
+	})
+	assert.EqualError(t, err, "goclub/sesison: NewHub(store, option) option.RequestCache store must implement sess.BulkStore")
+}
+
+// plainStore 只实现了 sess.Store，没有 BulkStore StoreToucher StoreUserIndexer 等可选能力
+type plainStore struct {
+	sess.Store
+}
@@ -0,0 +1,98 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChainReadWriter(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	newChain := func(writer http.ResponseWriter, request *http.Request) *sess.ChainReadWriter {
+		return sess.NewChainReadWriter(
+			sess.HeaderReadWriter{Writer: writer, Header: request.Header},
+			sess.CookieReadWriter{Writer: writer, Request: request},
+		)
+	}
+	// 客户端没有 sessionID 时通过所有 ReadWriter 写入
+	firstWriter := httptest.NewRecorder()
+	chain := newChain(firstWriter, httptest.NewRequest("GET", "/", nil))
+	session, err := hub.GetSessionByReadWriter(ctx, chain)
+	assert.NoError(t, err)
+	_, _, has := chain.Source()
+	assert.Equal(t, has, false)
+	assert.Equal(t, firstWriter.Header().Get("session"), session.ID())
+	assert.Contains(t, firstWriter.Header().Get("Set-Cookie"), "session_id="+session.ID())
+	// app 通过 header 传递
+	{
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("session", session.ID())
+		chain := newChain(httptest.NewRecorder(), request)
+		headerSession, err := hub.GetSessionByReadWriter(ctx, chain)
+		assert.NoError(t, err)
+		assert.Equal(t, headerSession.ID(), session.ID())
+		_, index, has := chain.Source()
+		assert.Equal(t, has, true)
+		assert.Equal(t, index, 0)
+	}
+	// 浏览器通过 cookie 传递
+	{
+		chain := newChain(httptest.NewRecorder(), requestWithCookie(firstWriter))
+		cookieSession, err := hub.GetSessionByReadWriter(ctx, chain)
+		assert.NoError(t, err)
+		assert.Equal(t, cookieSession.ID(), session.ID())
+		readWriter, index, has := chain.Source()
+		assert.Equal(t, has, true)
+		assert.Equal(t, index, 1)
+		_, isCookie := readWriter.(sess.CookieReadWriter)
+		assert.Equal(t, isCookie, true)
+	}
+	// session 过期后只通过提供 sessionID 的 ReadWriter 写入新的 sessionID
+	{
+		assert.NoError(t, store.Destroy(ctx, mustStoreKey(t, session.ID())))
+		writer := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("session", session.ID())
+		newSession, err := hub.GetSessionByReadWriter(ctx, newChain(writer, request))
+		assert.NoError(t, err)
+		assert.NotEqual(t, newSession.ID(), session.ID())
+		assert.Equal(t, writer.Header().Get("session"), newSession.ID())
+		assert.Equal(t, writer.Header().Get("Set-Cookie"), "")
+	}
+}
+
+// TestChainReadWriterForeignAuthorization Authorization 请求头使用其他认证方式时继续尝试下一个 ReadWriter
+func TestChainReadWriterForeignAuthorization(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("Authorization", "Basic bmltbzoxMjM0NTY=")
+	request.AddCookie(&http.Cookie{Name: "session_id", Value: sessionID})
+	writer := httptest.NewRecorder()
+	chain := sess.NewChainReadWriter(
+		sess.AuthorizationReadWriter{Writer: writer, Header: request.Header},
+		sess.CookieReadWriter{Writer: writer, Request: request},
+	)
+	session, err := hub.GetSessionByReadWriter(ctx, chain)
+	assert.NoError(t, err)
+	assert.Equal(t, session.ID(), sessionID)
+	_, index, has := chain.Source()
+	assert.Equal(t, has, true)
+	assert.Equal(t, index, 1)
+}
@@ -0,0 +1,150 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type codecUser struct {
+	ID   uint64
+	Name string
+}
+
+func TestCodec(t *testing.T) {
+	now := time.Unix(1600000000, 123).UTC()
+	for _, codec := range []sess.Codec{sess.JSONCodec{}, sess.GobCodec{}, sess.BinaryCodec{}} {
+		{
+			data, err := codec.Encode(int64(-42))
+			assert.NoError(t, err)
+			var value int64
+			assert.NoError(t, codec.Decode(data, &value))
+			assert.Equal(t, value, int64(-42))
+		}
+		{
+			data, err := codec.Encode(true)
+			assert.NoError(t, err)
+			var value bool
+			assert.NoError(t, codec.Decode(data, &value))
+			assert.Equal(t, value, true)
+		}
+		{
+			data, err := codec.Encode("nimo")
+			assert.NoError(t, err)
+			var value string
+			assert.NoError(t, codec.Decode(data, &value))
+			assert.Equal(t, value, "nimo")
+		}
+		{
+			data, err := codec.Encode(1.5)
+			assert.NoError(t, err)
+			var value float64
+			assert.NoError(t, codec.Decode(data, &value))
+			assert.Equal(t, value, 1.5)
+		}
+		{
+			data, err := codec.Encode(now)
+			assert.NoError(t, err)
+			var value time.Time
+			assert.NoError(t, codec.Decode(data, &value))
+			assert.True(t, value.Equal(now))
+		}
+	}
+	for _, codec := range []sess.Codec{sess.JSONCodec{}, sess.GobCodec{}} {
+		data, err := codec.Encode(codecUser{ID: 1, Name: "nimo"})
+		assert.NoError(t, err)
+		var value codecUser
+		assert.NoError(t, codec.Decode(data, &value))
+		assert.Equal(t, value, codecUser{ID: 1, Name: "nimo"})
+	}
+}
+
+func TestBinaryCodec(t *testing.T) {
+	codec := sess.BinaryCodec{}
+	{
+		data, err := codec.Encode([]byte{0, 1, 2})
+		assert.NoError(t, err)
+		var value []byte
+		assert.NoError(t, codec.Decode(data, &value))
+		assert.Equal(t, value, []byte{0, 1, 2})
+	}
+	{
+		data, err := codec.Encode(uint(300))
+		assert.NoError(t, err)
+		var value uint16
+		assert.NoError(t, codec.Decode(data, &value))
+		assert.Equal(t, value, uint16(300))
+		var overflow uint8
+		assert.Error(t, codec.Decode(data, &overflow))
+	}
+	// 类型标记与目标类型不一致
+	{
+		data, err := codec.Encode("18")
+		assert.NoError(t, err)
+		var value int
+		assert.EqualError(t, codec.Decode(data, &value), `goclub/session: BinaryCodec can not decode 's' into int`)
+	}
+	{
+		_, err := codec.Encode(codecUser{})
+		assert.EqualError(t, err, "goclub/session: BinaryCodec unsupported type testSess.codecUser")
+		_, err = codec.Encode(nil)
+		assert.EqualError(t, err, "goclub/session: BinaryCodec unsupported type <nil>")
+	}
+}
+
+func TestSessionTypedValue(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	for _, codec := range []sess.Codec{nil, sess.GobCodec{}, sess.BinaryCodec{}} {
+		hub, err := sess.NewHub(store, sess.HubOption{
+			SecureKey: testSecureKey,
+			Codec:     codec,
+		})
+		assert.NoError(t, err)
+		sessionID, err := hub.NewSessionID(ctx)
+		assert.NoError(t, err)
+		session, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		{
+			_, has, err := session.GetInt(ctx, "age")
+			assert.NoError(t, err)
+			assert.Equal(t, has, false)
+		}
+		assert.NoError(t, session.SetInt(ctx, "age", 18))
+		assert.NoError(t, session.SetBool(ctx, "admin", true))
+		now := time.Now()
+		assert.NoError(t, session.SetTime(ctx, "login_time", now))
+		assert.NoError(t, session.SetJSON(ctx, "user", codecUser{ID: 1, Name: "nimo"}))
+		{
+			age, has, err := session.GetInt(ctx, "age")
+			assert.NoError(t, err)
+			assert.Equal(t, has, true)
+			assert.Equal(t, age, int64(18))
+			admin, has, err := session.GetBool(ctx, "admin")
+			assert.NoError(t, err)
+			assert.Equal(t, has, true)
+			assert.Equal(t, admin, true)
+			loginTime, has, err := session.GetTime(ctx, "login_time")
+			assert.NoError(t, err)
+			assert.Equal(t, has, true)
+			assert.True(t, loginTime.Equal(now))
+			var user codecUser
+			has, err = session.GetJSON(ctx, "user", &user)
+			assert.NoError(t, err)
+			assert.Equal(t, has, true)
+			assert.Equal(t, user, codecUser{ID: 1, Name: "nimo"})
+		}
+		// 解码失败返回 *sess.DecodeError
+		{
+			assert.NoError(t, session.Set(ctx, "age", "eighteen"))
+			_, _, err := session.GetInt(ctx, "age")
+			decodeErr, asDecodeError := sess.AsDecodeError(err)
+			assert.Equal(t, asDecodeError, true)
+			assert.Equal(t, decodeErr.Field, "age")
+			assert.Equal(t, decodeErr.Value, "eighteen")
+		}
+	}
+}
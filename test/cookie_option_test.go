@@ -0,0 +1,84 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCookieOption(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	{
+		hub, err := sess.NewHub(store, sess.HubOption{
+			SecureKey: testSecureKey,
+		})
+		assert.NoError(t, err)
+		writer := httptest.NewRecorder()
+		_, err = hub.GetSessionByCookie(ctx, writer, httptest.NewRequest("GET", "/", nil))
+		assert.NoError(t, err)
+		setCookie := writer.Header().Get("Set-Cookie")
+		assert.Contains(t, setCookie, "HttpOnly")
+		assert.NotContains(t, setCookie, "SameSite")
+		assert.NotContains(t, setCookie, "Partitioned")
+	}
+	{
+		hub, err := sess.NewHub(store, sess.HubOption{
+			SecureKey: testSecureKey,
+			Cookie: sess.HubOptionCookie{
+				Name:            "__Host-session_id",
+				Secure:          true,
+				SameSite:        http.SameSiteNoneMode,
+				DisableHttpOnly: true,
+				Partitioned:     true,
+			},
+		})
+		assert.NoError(t, err)
+		writer := httptest.NewRecorder()
+		session, err := hub.GetSessionByCookie(ctx, writer, httptest.NewRequest("GET", "/", nil))
+		assert.NoError(t, err)
+		setCookie := writer.Header().Get("Set-Cookie")
+		assert.Contains(t, setCookie, "__Host-session_id=")
+		assert.Contains(t, setCookie, "; Secure")
+		assert.Contains(t, setCookie, "; SameSite=None")
+		assert.Contains(t, setCookie, "; Partitioned")
+		assert.NotContains(t, setCookie, "HttpOnly")
+		// 删除 cookie 时保留 Partitioned 属性，否则浏览器不会删除分区 cookie
+		destroyWriter := httptest.NewRecorder()
+		session, err = hub.GetSessionByCookie(ctx, destroyWriter, requestWithCookie(writer))
+		assert.NoError(t, err)
+		assert.NoError(t, session.Destroy(ctx))
+		assert.Contains(t, destroyWriter.Header().Get("Set-Cookie"), "; Partitioned")
+	}
+}
+
+func TestCookieOptionCheck(t *testing.T) {
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	for _, item := range []struct {
+		cookie sess.HubOptionCookie
+		err    string
+	}{
+		{sess.HubOptionCookie{SameSite: http.SameSiteNoneMode}, "goclub/session: NewHub(store, option) option.Cookie.SameSite is http.SameSiteNoneMode, option.Cookie.Secure must be true"},
+		{sess.HubOptionCookie{Partitioned: true}, "goclub/session: NewHub(store, option) option.Cookie.Partitioned is true, option.Cookie.Secure must be true"},
+		{sess.HubOptionCookie{Name: "__Secure-id"}, "goclub/session: NewHub(store, option) option.Cookie.Name has __Secure- prefix, option.Cookie.Secure must be true"},
+		{sess.HubOptionCookie{Name: "__Host-id"}, "goclub/session: NewHub(store, option) option.Cookie.Name has __Host- prefix, option.Cookie.Secure must be true"},
+		{sess.HubOptionCookie{Name: "__Host-id", Secure: true, Path: "/admin"}, "goclub/session: NewHub(store, option) option.Cookie.Name has __Host- prefix, option.Cookie.Path must be /"},
+		{sess.HubOptionCookie{Name: "__Host-id", Secure: true, Domain: "goclub.run"}, "goclub/session: NewHub(store, option) option.Cookie.Name has __Host- prefix, option.Cookie.Domain must be empty"},
+		{sess.HubOptionCookie{Name: "__Secure-id", Secure: true, SameSite: http.SameSiteStrictMode}, ""},
+	} {
+		_, err := sess.NewHub(store, sess.HubOption{
+			SecureKey: testSecureKey,
+			Cookie:    item.cookie,
+		})
+		if item.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, item.err)
+		}
+	}
+}
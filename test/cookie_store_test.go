@@ -0,0 +1,146 @@
+package testSess
+
+import (
+	"context"
+	xerr "github.com/goclub/error"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCookieStoreHub(t *testing.T, option sess.CookieStoreOption) (*sess.CookieStore, *sess.Hub) {
+	option.Key = []byte("bf4f4ac1c7e14a389ae1b5c8a2fb5f2a")
+	cookieStore, err := sess.NewCookieStore(option)
+	assert.NoError(t, err)
+	hub, err := sess.NewHub(cookieStore, sess.HubOption{
+		SecureKey: testSecureKey,
+		Middleware: sess.HubOptionMiddleware{
+			ReadWriter: cookieStore.ReadWriter,
+		},
+	})
+	assert.NoError(t, err)
+	return cookieStore, hub
+}
+
+func TestCookieStore(t *testing.T) {
+	_, hub := newCookieStoreHub(t, sess.CookieStoreOption{})
+	handler := hub.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+		session, _ := sess.FromContext(ctx)
+		switch request.URL.Path {
+		case "/set":
+			assert.NoError(t, session.Set(ctx, "name", "nimo"))
+			assert.NoError(t, session.Set(ctx, "age", "18"))
+		case "/get":
+			value, _, err := session.Get(ctx, "name")
+			assert.NoError(t, err)
+			_, _ = writer.Write([]byte(value))
+		case "/destroy":
+			assert.NoError(t, session.Destroy(ctx))
+		}
+	}))
+	setWriter := httptest.NewRecorder()
+	handler.ServeHTTP(setWriter, httptest.NewRequest("GET", "/set", nil))
+	// 同一个请求多次修改只会有一个 set-cookie
+	assert.Equal(t, len(setWriter.Header()["Set-Cookie"]), 1)
+	cookie := setWriter.Result().Cookies()[0]
+	assert.Equal(t, cookie.Name, "session_id")
+	assert.Equal(t, cookie.HttpOnly, true)
+	// cookie 中的数据是加密的
+	assert.NotContains(t, cookie.Value, "nimo")
+	{
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, requestWithPathCookie("/get", setWriter))
+		assert.Equal(t, writer.Body.String(), "nimo")
+	}
+	// 篡改的 cookie 视为没有 session
+	{
+		request := httptest.NewRequest("GET", "/get", nil)
+		request.AddCookie(&http.Cookie{Name: "session_id", Value: cookie.Value[:len(cookie.Value)-2] + "AA"})
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, request)
+		assert.Equal(t, writer.Body.String(), "")
+	}
+	{
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, requestWithPathCookie("/destroy", setWriter))
+		assert.Contains(t, writer.Header().Get("Set-Cookie"), "Max-Age=0")
+	}
+}
+
+func TestCookieStoreChunk(t *testing.T) {
+	ctx := context.Background()
+	cookieStore, hub := newCookieStoreHub(t, sess.CookieStoreOption{
+		ChunkSize: 500,
+		MaxChunks: 3,
+	})
+	setWriter := httptest.NewRecorder()
+	session, err := hub.GetSessionByReadWriter(ctx, cookieStore.ReadWriter(setWriter, httptest.NewRequest("GET", "/", nil)))
+	assert.NoError(t, err)
+	large := strings.Repeat("a", 800)
+	assert.NoError(t, session.Set(ctx, "large", large))
+	// 超过 ChunkSize 拆分为多个 cookie
+	cookies := setWriter.Result().Cookies()
+	assert.Equal(t, len(cookies), 3)
+	assert.Equal(t, cookies[0].Name, "session_id")
+	assert.Equal(t, cookies[1].Name, "session_id.1")
+	assert.Equal(t, cookies[2].Name, "session_id.2")
+	// 超过 ChunkSize * MaxChunks
+	err = session.Set(ctx, "too_large", large)
+	assert.Equal(t, xerr.Is(err, sess.ErrCookieStoreTooLarge), true)
+	{
+		writer := httptest.NewRecorder()
+		session, err := hub.GetSessionByReadWriter(ctx, cookieStore.ReadWriter(writer, requestWithCookie(setWriter)))
+		assert.NoError(t, err)
+		value, has, err := session.Get(ctx, "large")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, value, large)
+		// 数据变小后删除多余的 cookie
+		assert.NoError(t, session.Delete(ctx, "large"))
+		cookies := writer.Result().Cookies()
+		assert.Equal(t, len(cookies), 3)
+		assert.Equal(t, cookies[1].MaxAge, -1)
+		assert.Equal(t, cookies[2].MaxAge, -1)
+	}
+}
+
+func TestCookieStoreExpire(t *testing.T) {
+	ctx := context.Background()
+	cookieStore, err := sess.NewCookieStore(sess.CookieStoreOption{Key: []byte("bf4f4ac1c7e14a389ae1b5c8a2fb5f2a")})
+	assert.NoError(t, err)
+	hub, err := sess.NewHub(cookieStore, sess.HubOption{
+		SecureKey:  testSecureKey,
+		SessionTTL: time.Second,
+	})
+	assert.NoError(t, err)
+	setWriter := httptest.NewRecorder()
+	session, err := hub.GetSessionByReadWriter(ctx, cookieStore.ReadWriter(setWriter, httptest.NewRequest("GET", "/", nil)))
+	assert.NoError(t, err)
+	assert.NoError(t, session.Set(ctx, "name", "nimo"))
+	time.Sleep(time.Second + time.Millisecond*100)
+	// 客户端重放已过期的 cookie
+	session, err = hub.GetSessionByReadWriter(ctx, cookieStore.ReadWriter(httptest.NewRecorder(), requestWithCookie(setWriter)))
+	assert.NoError(t, err)
+	_, has, err := session.Get(ctx, "name")
+	assert.NoError(t, err)
+	assert.Equal(t, has, false)
+	// 不能直接使用 CookieStore
+	_, err = hub.NewSessionID(ctx)
+	assert.Error(t, err)
+	_, err = sess.NewHub(cookieStore, sess.HubOption{
+		SecureKey:    testSecureKey,
+		RequestCache: true,
+	})
+	assert.Error(t, err)
+}
+
+func requestWithPathCookie(path string, recorder *httptest.ResponseRecorder) *http.Request {
+	request := requestWithCookie(recorder)
+	request.URL.Path = path
+	return request
+}
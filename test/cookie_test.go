@@ -31,3 +31,18 @@ func TestTestCookie(t *testing.T) {
 		SessionTTL: time.Hour * 1,
 	})
 }
+
+func TestRedisStoreSuite(t *testing.T) {
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{
+		Network: "tcp",
+		Addr:    "127.0.0.1:6379",
+	})
+	assert.NoError(t, client.Ping(ctx).Err())
+	RunStoreSuite(t, func() sess.Store {
+		return sess.NewRedisStore(sess.RedisStoreOption{
+			Client:         red.NewGoRedisV8(client),
+			StoreKeyPrefix: "project_session_name",
+		})
+	})
+}
@@ -0,0 +1,102 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFToken(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	newSession := func() sess.Session {
+		sessionID, err := hub.NewSessionID(ctx)
+		assert.NoError(t, err)
+		session, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		return session
+	}
+	session := newSession()
+	// 没有 csrf 秘钥时验证失败
+	{
+		valid, err := session.VerifyCSRFToken(ctx, "")
+		assert.NoError(t, err)
+		assert.Equal(t, valid, false)
+	}
+	token1, err := session.CSRFToken(ctx)
+	assert.NoError(t, err)
+	token2, err := session.CSRFToken(ctx)
+	assert.NoError(t, err)
+	// 每次生成的 token 不同但都有效
+	assert.NotEqual(t, token1, token2)
+	for _, token := range []string{token1, token2} {
+		valid, err := session.VerifyCSRFToken(ctx, token)
+		assert.NoError(t, err)
+		assert.Equal(t, valid, true)
+	}
+	// 其他 session 的 token 无效
+	{
+		valid, err := newSession().VerifyCSRFToken(ctx, token1)
+		assert.NoError(t, err)
+		assert.Equal(t, valid, false)
+	}
+	for _, token := range []string{"", "abc", token1[:len(token1)-2], strings.ToUpper(token1)} {
+		valid, err := session.VerifyCSRFToken(ctx, token)
+		assert.NoError(t, err)
+		assert.Equal(t, valid, false)
+	}
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	var token string
+	handler := hub.Middleware(hub.CSRFMiddleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		session, _ := sess.FromContext(request.Context())
+		if request.Method == "GET" {
+			var err error
+			token, err = session.CSRFToken(request.Context())
+			assert.NoError(t, err)
+		}
+	})))
+	getWriter := httptest.NewRecorder()
+	handler.ServeHTTP(getWriter, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, getWriter.Code, http.StatusOK)
+	post := func(header string, form string) int {
+		request := httptest.NewRequest("POST", "/", strings.NewReader(form))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header != "" {
+			request.Header.Set("X-CSRF-Token", header)
+		}
+		for _, cookie := range getWriter.Result().Cookies() {
+			request.AddCookie(cookie)
+		}
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, request)
+		return writer.Code
+	}
+	assert.Equal(t, post("", ""), http.StatusForbidden)
+	assert.Equal(t, post("wrong", ""), http.StatusForbidden)
+	assert.Equal(t, post(token, ""), http.StatusOK)
+	assert.Equal(t, post("", url.Values{"csrf_token": {token}}.Encode()), http.StatusOK)
+	// 未使用 hub.Middleware()
+	{
+		writer := httptest.NewRecorder()
+		hub.CSRFMiddleware(http.NotFoundHandler()).ServeHTTP(writer, httptest.NewRequest("POST", "/", nil))
+		assert.Equal(t, writer.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,114 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newFileStore(t *testing.T) *sess.FileStore {
+	store, err := sess.NewFileStore(sess.FileStoreOption{
+		Dir: t.TempDir(),
+	})
+	assert.NoError(t, err)
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestFileStoreSuite(t *testing.T) {
+	RunStoreSuite(t, func() sess.Store {
+		return newFileStore(t)
+	})
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	storeKey := newStoreKey()
+	{
+		store, err := sess.NewFileStore(sess.FileStoreOption{Dir: dir})
+		assert.NoError(t, err)
+		assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+		assert.NoError(t, store.Set(ctx, storeKey, "name", "nimo"))
+		store.Close()
+	}
+	// 重启后 session 仍然存在
+	{
+		store, err := sess.NewFileStore(sess.FileStoreOption{Dir: dir})
+		assert.NoError(t, err)
+		defer store.Close()
+		value, has, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "nimo")
+		assert.Equal(t, has, true)
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+	}
+}
+
+func TestFileStoreInvalidStoreKey(t *testing.T) {
+	ctx := context.Background()
+	store := newFileStore(t)
+	_, _, err := store.Get(ctx, "../../etc/passwd", "name")
+	assert.Error(t, err)
+}
+
+func TestFileStoreDeleteStaleTemp(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := sess.NewFileStore(sess.FileStoreOption{Dir: dir, SweepInterval: -1})
+	assert.NoError(t, err)
+	defer store.Close()
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	// 模拟 write 和 rename 之间崩溃遗留的临时文件
+	subDir := filepath.Join(dir, storeKey[:2])
+	staleTemp := filepath.Join(subDir, ".tmp-"+storeKey+".123456")
+	assert.NoError(t, ioutil.WriteFile(staleTemp, []byte("{}"), 0600))
+	// 不是 FileStore 创建的文件不会被删除
+	foreignTemp := filepath.Join(subDir, ".tmp-654321")
+	assert.NoError(t, ioutil.WriteFile(foreignTemp, []byte("{}"), 0600))
+	assert.NoError(t, store.DeleteExpired())
+	{
+		_, err := os.Stat(staleTemp)
+		assert.Equal(t, os.IsNotExist(err), true)
+	}
+	{
+		_, err := os.Stat(foreignTemp)
+		assert.NoError(t, err)
+	}
+	existed, err := store.StoreKeyExists(ctx, storeKey)
+	assert.NoError(t, err)
+	assert.Equal(t, existed, true)
+}
+
+// TestFileStoreSweepDuringWrite 清理临时文件时持有 storeKey 的锁，不会删除正在写入的临时文件
+func TestFileStoreSweepDuringWrite(t *testing.T) {
+	ctx := context.Background()
+	store, err := sess.NewFileStore(sess.FileStoreOption{Dir: t.TempDir(), SweepInterval: -1})
+	assert.NoError(t, err)
+	defer store.Close()
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			assert.NoError(t, store.DeleteExpired())
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		assert.NoError(t, store.Set(ctx, storeKey, "count", strconv.Itoa(i)))
+	}
+	<-done
+	value, _, err := store.Get(ctx, storeKey, "count")
+	assert.NoError(t, err)
+	assert.Equal(t, value, "199")
+}
@@ -0,0 +1,104 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestFlash(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	for _, requestCache := range []bool{false, true} {
+		hub, err := sess.NewHub(store, sess.HubOption{
+			SecureKey:    testSecureKey,
+			RequestCache: requestCache,
+		})
+		assert.NoError(t, err)
+		sessionID, err := hub.NewSessionID(ctx)
+		assert.NoError(t, err)
+		session, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		{
+			messages, err := session.Flashes(ctx, "success")
+			assert.NoError(t, err)
+			assert.Equal(t, len(messages), 0)
+		}
+		assert.NoError(t, session.AddFlash(ctx, "success", "保存成功"))
+		assert.NoError(t, session.AddFlash(ctx, "success", "已发送邮件"))
+		assert.NoError(t, session.AddFlash(ctx, "error", "头像上传失败"))
+		// 下一个请求读取
+		next, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		{
+			messages, err := next.Flashes(ctx, "success")
+			assert.NoError(t, err)
+			assert.Equal(t, messages, []string{"保存成功", "已发送邮件"})
+		}
+		// 读取后清除
+		{
+			messages, err := next.Flashes(ctx, "success")
+			assert.NoError(t, err)
+			assert.Equal(t, len(messages), 0)
+		}
+		{
+			messages, err := session.Flashes(ctx, "error")
+			assert.NoError(t, err)
+			assert.Equal(t, messages, []string{"头像上传失败"})
+		}
+	}
+}
+
+func TestFlashWithoutGetDeleter(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := sess.NewMemoryStore()
+	defer memoryStore.Close()
+	hub, err := sess.NewHub(plainStore{Store: memoryStore}, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	session, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+	assert.NoError(t, err)
+	assert.NoError(t, session.AddFlash(ctx, "success", "保存成功"))
+	messages, err := session.Flashes(ctx, "success")
+	assert.NoError(t, err)
+	assert.Equal(t, messages, []string{"保存成功"})
+	messages, err = session.Flashes(ctx, "success")
+	assert.NoError(t, err)
+	assert.Equal(t, len(messages), 0)
+}
+
+// TestFlashConcurrentAdd Store 实现了 StoreAppender 时并发添加 flash 不会丢失消息
+func TestFlashConcurrentAdd(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			session, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+			assert.NoError(t, err)
+			assert.NoError(t, session.AddFlash(ctx, "success", strconv.Itoa(i)))
+		}(i)
+	}
+	wg.Wait()
+	session, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+	assert.NoError(t, err)
+	messages, err := session.Flashes(ctx, "success")
+	assert.NoError(t, err)
+	assert.Equal(t, len(messages), 20)
+}
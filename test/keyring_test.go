@@ -0,0 +1,116 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// requestWithCookie 将上一次响应的 set-cookie 带到新的请求中
+func requestWithCookie(recorder *httptest.ResponseRecorder) *http.Request {
+	request := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range recorder.Result().Cookies() {
+		request.AddCookie(cookie)
+	}
+	return request
+}
+
+func TestSecureKeyringRotate(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	key1 := sess.SecureKeyringKey{ID: "k1", Key: []byte("e9a2f9cbfab74abaa472ff7385dd8224")}
+	key2 := sess.SecureKeyringKey{ID: "k2", Key: []byte("2b1bb0fb6c8e4fd6a1c4b8ad7de4b0b1")}
+	hub1, err := sess.NewHub(store, sess.HubOption{
+		SecureKeyring: sess.SecureKeyring{Primary: key1},
+		Security:      sess.AEADSecurity{},
+	})
+	assert.NoError(t, err)
+	writer := httptest.NewRecorder()
+	session, err := hub1.GetSessionByCookie(ctx, writer, httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(session.ID(), "k1."))
+	assert.NoError(t, session.Set(ctx, "name", "nimo"))
+
+	hub2, err := sess.NewHub(store, sess.HubOption{
+		SecureKeyring: sess.SecureKeyring{Primary: key2, Retired: []sess.SecureKeyringKey{key1}},
+		Security:      sess.AEADSecurity{},
+	})
+	assert.NoError(t, err)
+	newWriter := httptest.NewRecorder()
+	newSession, err := hub2.GetSessionByCookie(ctx, newWriter, requestWithCookie(writer))
+	assert.NoError(t, err)
+	// 使用旧秘钥的 sessionID 以新秘钥重新签发，数据不丢失
+	assert.True(t, strings.HasPrefix(newSession.ID(), "k2."))
+	assert.Contains(t, newWriter.Header().Get("set-cookie"), "session_id="+newSession.ID())
+	value, has, err := newSession.Get(ctx, "name")
+	assert.NoError(t, err)
+	assert.Equal(t, has, true)
+	assert.Equal(t, value, "nimo")
+	// 使用新秘钥的 sessionID 不会重新签发
+	{
+		writer := httptest.NewRecorder()
+		session, err := hub2.GetSessionByCookie(ctx, writer, requestWithCookie(newWriter))
+		assert.NoError(t, err)
+		assert.Equal(t, session.ID(), newSession.ID())
+		assert.Equal(t, writer.Header().Get("set-cookie"), "")
+	}
+	// 秘钥被移除后旧 sessionID 无法解密
+	hub3, err := sess.NewHub(store, sess.HubOption{
+		SecureKeyring: sess.SecureKeyring{Primary: key2},
+		Security:      sess.AEADSecurity{},
+	})
+	assert.NoError(t, err)
+	_, err = hub3.GetSessionByCookie(ctx, httptest.NewRecorder(), requestWithCookie(writer))
+	assert.Error(t, err)
+}
+
+func TestSecureKeyringMigrateFromSecureKey(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub1, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	writer := httptest.NewRecorder()
+	session, err := hub1.GetSessionByCookie(ctx, writer, httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	assert.NoError(t, session.Set(ctx, "name", "nimo"))
+
+	hub2, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:     testSecureKey,
+		SecureKeyring: sess.SecureKeyring{Primary: sess.SecureKeyringKey{ID: "k1", Key: []byte("2b1bb0fb6c8e4fd6a1c4b8ad7de4b0b1")}},
+	})
+	assert.NoError(t, err)
+	newSession, err := hub2.GetSessionByCookie(ctx, httptest.NewRecorder(), requestWithCookie(writer))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(newSession.ID(), "k1."))
+	value, _, err := newSession.Get(ctx, "name")
+	assert.NoError(t, err)
+	assert.Equal(t, value, "nimo")
+}
+
+func TestSecureKeyringCheck(t *testing.T) {
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	_, err := sess.NewHub(store, sess.HubOption{
+		SecureKeyring: sess.SecureKeyring{Primary: sess.SecureKeyringKey{ID: "k.1", Key: testSecureKey}},
+	})
+	assert.Error(t, err)
+	_, err = sess.NewHub(store, sess.HubOption{
+		SecureKeyring: sess.SecureKeyring{Primary: sess.SecureKeyringKey{ID: "k1", Key: []byte("short")}},
+	})
+	assert.Error(t, err)
+	_, err = sess.NewHub(store, sess.HubOption{
+		SecureKeyring: sess.SecureKeyring{
+			Primary: sess.SecureKeyringKey{ID: "k1", Key: testSecureKey},
+			Retired: []sess.SecureKeyringKey{{ID: "k1", Key: testSecureKey}},
+		},
+	})
+	assert.Error(t, err)
+}
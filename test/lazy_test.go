@@ -0,0 +1,85 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countStore 记录 store 被调用的次数
+type countStore struct {
+	*sess.MemoryStore
+	count int64
+}
+
+func (s *countStore) InitSession(ctx context.Context, storeKey string, sessionTTL time.Duration) (err error) {
+	atomic.AddInt64(&s.count, 1)
+	return s.MemoryStore.InitSession(ctx, storeKey, sessionTTL)
+}
+func (s *countStore) StoreKeyExists(ctx context.Context, storeKey string) (existed bool, err error) {
+	atomic.AddInt64(&s.count, 1)
+	return s.MemoryStore.StoreKeyExists(ctx, storeKey)
+}
+func (s *countStore) Get(ctx context.Context, storeKey string, field string) (value string, hasValue bool, err error) {
+	atomic.AddInt64(&s.count, 1)
+	return s.MemoryStore.Get(ctx, storeKey, field)
+}
+func (s *countStore) Count() int64 {
+	return atomic.LoadInt64(&s.count)
+}
+
+func TestLazySession(t *testing.T) {
+	ctx := context.Background()
+	store := &countStore{MemoryStore: sess.NewMemoryStore()}
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:   testSecureKey,
+		LazySession: true,
+	})
+	assert.NoError(t, err)
+	writer := httptest.NewRecorder()
+	session, err := hub.GetSessionByCookie(ctx, writer, httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	{
+		value, has, err := session.Get(ctx, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "")
+		assert.Equal(t, has, false)
+		assert.Equal(t, session.ID(), "")
+	}
+	// 没有 Set 时不会访问 store 也不会 set-cookie
+	assert.Equal(t, store.Count(), int64(0))
+	assert.Equal(t, writer.Header().Get("set-cookie"), "")
+
+	assert.NoError(t, session.Set(ctx, "name", "nimo"))
+	assert.NotEqual(t, session.ID(), "")
+	assert.Contains(t, writer.Header().Get("set-cookie"), "session_id="+session.ID())
+	{
+		session, err := hub.GetSessionByCookie(ctx, httptest.NewRecorder(), requestWithCookie(writer))
+		assert.NoError(t, err)
+		value, has, err := session.Get(ctx, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "nimo")
+		assert.Equal(t, has, true)
+	}
+	// session 过期后返回未创建的 session 并清除客户端 cookie
+	assert.NoError(t, store.Destroy(ctx, mustStoreKey(t, session.ID())))
+	{
+		expiredWriter := httptest.NewRecorder()
+		session, err := hub.GetSessionByCookie(ctx, expiredWriter, requestWithCookie(writer))
+		assert.NoError(t, err)
+		assert.Equal(t, session.ID(), "")
+		assert.Contains(t, expiredWriter.Header().Get("set-cookie"), "Max-Age=0")
+	}
+}
+
+// mustStoreKey 使用与 hub 相同的 Security 解密 sessionID 得到 storeKey
+func mustStoreKey(t *testing.T, sessionID string) string {
+	storeKey, err := sess.DefaultSecurity{}.Decrypt([]byte(sessionID), testSecureKey)
+	assert.NoError(t, err)
+	return string(storeKey)
+}
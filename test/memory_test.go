@@ -0,0 +1,88 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreCookie(t *testing.T) {
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	TestCookie(t, store, sess.HubOption{
+		SecureKey: []byte("e9a2f9cbfab74abaa472ff7385dd8224"),
+		Cookie: sess.HubOptionCookie{
+			Name: "project_name_session_cookie",
+		},
+		SessionTTL: time.Hour * 1,
+	})
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	assert.NoError(t, store.InitSession(ctx, "a", time.Millisecond*50))
+	{
+		existed, err := store.StoreKeyExists(ctx, "a")
+		assert.NoError(t, err)
+		assert.Equal(t, existed, true)
+		_, has, err := store.Get(ctx, "a", "__goclub_session_create_time")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+	}
+	time.Sleep(time.Millisecond * 80)
+	{
+		existed, err := store.StoreKeyExists(ctx, "a")
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+		ttl, err := store.StoreKeyRemainingTTL(ctx, "a")
+		assert.NoError(t, err)
+		assert.Equal(t, ttl, time.Duration(0))
+	}
+}
+
+func TestMemoryStoreSuite(t *testing.T) {
+	RunStoreSuite(t, func() sess.Store {
+		return sess.NewMemoryStore()
+	})
+}
+
+func TestMemoryStoreJanitor(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStoreWithOption(sess.MemoryStoreOption{
+		JanitorInterval: time.Millisecond * 20,
+	})
+	defer store.Close()
+	assert.NoError(t, store.InitSession(ctx, "a", time.Millisecond*30))
+	assert.NoError(t, store.InitSession(ctx, "b", time.Hour))
+	_, err := store.BindUser(ctx, "a", "1", sess.UserSessionMeta{})
+	assert.NoError(t, err)
+	assert.Equal(t, store.Len(), 2)
+	// 后台清理过期的 key
+	time.Sleep(time.Millisecond * 150)
+	assert.Equal(t, store.Len(), 1)
+	sessions, err := store.UserSessions(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, len(sessions), 0)
+	existed, err := store.StoreKeyExists(ctx, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, existed, true)
+}
+
+// TestMemoryStoreJanitorDisabled JanitorInterval 小于 0 时不启动后台清理，过期的 key 仍然不会被读取到
+func TestMemoryStoreJanitorDisabled(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStoreWithOption(sess.MemoryStoreOption{
+		JanitorInterval: -1,
+	})
+	defer store.Close()
+	assert.NoError(t, store.InitSession(ctx, "a", time.Millisecond*10))
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, store.Len(), 1)
+	existed, err := store.StoreKeyExists(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, existed, false)
+}
@@ -0,0 +1,214 @@
+package testSess
+
+import (
+	"context"
+	"errors"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMetadataMap(t *testing.T) {
+	md := sess.MetadataMap{}
+	md.Set("Session", "a")
+	assert.Equal(t, md.Get("session"), []string{"a"})
+	assert.Equal(t, md.Get("SESSION"), []string{"a"})
+	md.Set("session")
+	assert.Equal(t, md.Get("session"), []string{"a"})
+}
+
+type incomingKey struct{}
+
+func newMetadataTransport(sent *[]sess.MetadataMap) sess.MetadataTransport {
+	return sess.MetadataTransport{
+		Incoming: func(ctx context.Context) sess.MetadataCarrier {
+			md, _ := ctx.Value(incomingKey{}).(sess.MetadataMap)
+			return md
+		},
+		SendHeader: func(ctx context.Context, outgoing sess.MetadataMap) error {
+			*sent = append(*sent, outgoing)
+			return nil
+		},
+	}
+}
+
+func TestUnaryServerSession(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	var sent []sess.MetadataMap
+	unary := hub.UnaryServerSession(newMetadataTransport(&sent))
+	// 没有 metadata 时创建新的 session 并发送响应 metadata
+	var sessionID string
+	resp, err := unary(ctx, "req", func(ctx context.Context, req interface{}) (interface{}, error) {
+		session, has := sess.FromContext(ctx)
+		assert.Equal(t, has, true)
+		sessionID = session.ID()
+		return req, session.Set(ctx, "name", "nimo")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, resp, "req")
+	assert.Equal(t, len(sent), 1)
+	assert.Equal(t, sent[0].Get("session"), []string{sessionID})
+	// 携带 sessionID 时不发送响应 metadata
+	sent = nil
+	incomingCtx := context.WithValue(ctx, incomingKey{}, sess.MetadataMap{"session": {sessionID}})
+	_, err = unary(incomingCtx, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+		session, has := sess.FromContext(ctx)
+		assert.Equal(t, has, true)
+		assert.Equal(t, session.ID(), sessionID)
+		value, _, err := session.Get(ctx, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "nimo")
+		return nil, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, len(sent), 0)
+	// handler 中 Regenerate 会通知客户端
+	var newSessionID string
+	_, err = unary(incomingCtx, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+		session, has := sess.FromContext(ctx)
+		assert.Equal(t, has, true)
+		err := session.Regenerate(ctx)
+		newSessionID = session.ID()
+		return nil, err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, len(sent), 1)
+	assert.Equal(t, sent[0].Get("session"), []string{newSessionID})
+	assert.NotEqual(t, newSessionID, sessionID)
+	// handler 的错误原样返回，创建的 session 仍会通知客户端
+	sent = nil
+	handlerErr := errors.New("handler")
+	_, err = unary(ctx, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+		session, _ := sess.FromContext(ctx)
+		sessionID = session.ID()
+		return nil, handlerErr
+	})
+	assert.Equal(t, err, handlerErr)
+	assert.Equal(t, len(sent), 1)
+	assert.Equal(t, sent[0].Get("session"), []string{sessionID})
+}
+
+func TestStreamServerSession(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+		Metadata: sess.HubOptionMetadata{
+			Key: "x-session",
+		},
+	})
+	assert.NoError(t, err)
+	var sent []sess.MetadataMap
+	stream := hub.StreamServerSession(newMetadataTransport(&sent))
+	var sessionID string
+	err = stream(ctx, func(ctx context.Context, sendHeader func() error) error {
+		session, has := sess.FromContext(ctx)
+		assert.Equal(t, has, true)
+		sessionID = session.ID()
+		// 模拟 SendMsg 前发送 header，只发送一次
+		assert.NoError(t, sendHeader())
+		assert.NoError(t, sendHeader())
+		assert.Equal(t, len(sent), 1)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, len(sent), 1)
+	assert.Equal(t, sent[0].Get("x-session"), []string{sessionID})
+	// 携带 sessionID 时不发送响应 metadata
+	incomingCtx := context.WithValue(ctx, incomingKey{}, sess.MetadataMap{"x-session": {sessionID}})
+	err = stream(incomingCtx, func(ctx context.Context, sendHeader func() error) error {
+		session, has := sess.FromContext(ctx)
+		assert.Equal(t, has, true)
+		assert.Equal(t, session.ID(), sessionID)
+		return sendHeader()
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, len(sent), 1)
+	// handler 的错误原样返回，创建的 session 仍会通知客户端
+	sent = nil
+	handlerErr := errors.New("handler")
+	err = stream(ctx, func(ctx context.Context, sendHeader func() error) error {
+		session, _ := sess.FromContext(ctx)
+		sessionID = session.ID()
+		return handlerErr
+	})
+	assert.Equal(t, err, handlerErr)
+	assert.Equal(t, len(sent), 1)
+	assert.Equal(t, sent[0].Get("x-session"), []string{sessionID})
+}
+
+// TestStreamServerSessionLazy handler 中创建的 LazySession 在 sendHeader 时通知客户端
+func TestStreamServerSessionLazy(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:   testSecureKey,
+		LazySession: true,
+	})
+	assert.NoError(t, err)
+	var sent []sess.MetadataMap
+	stream := hub.StreamServerSession(newMetadataTransport(&sent))
+	// 调用 sendHeader 前创建 session
+	var sessionID string
+	err = stream(ctx, func(ctx context.Context, sendHeader func() error) error {
+		session, _ := sess.FromContext(ctx)
+		assert.NoError(t, session.Set(ctx, "name", "nimo"))
+		sessionID = session.ID()
+		return sendHeader()
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, len(sent), 1)
+	assert.Equal(t, sent[0].Get("session"), []string{sessionID})
+	// handler 没有调用 sendHeader 时在 handler 执行后发送
+	sent = nil
+	err = stream(ctx, func(ctx context.Context, sendHeader func() error) error {
+		session, _ := sess.FromContext(ctx)
+		assert.NoError(t, session.Set(ctx, "name", "nimo"))
+		sessionID = session.ID()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, len(sent), 1)
+	assert.Equal(t, sent[0].Get("session"), []string{sessionID})
+}
+
+// TestStreamServerSessionFlush 开启 RequestCache 时 sendHeader 前写入 handler 中的修改
+func TestStreamServerSessionFlush(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:    testSecureKey,
+		RequestCache: true,
+	})
+	assert.NoError(t, err)
+	// 不使用 RequestCache 的 hub 直接读取 store
+	plainHub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	var sent []sess.MetadataMap
+	stream := hub.StreamServerSession(newMetadataTransport(&sent))
+	err = stream(ctx, func(ctx context.Context, sendHeader func() error) error {
+		session, _ := sess.FromContext(ctx)
+		assert.NoError(t, session.Set(ctx, "name", "nimo"))
+		assert.NoError(t, sendHeader())
+		stored, err := plainHub.GetSessionByMetadata(ctx, sess.MetadataMap{"session": {session.ID()}}, sess.MetadataMap{})
+		assert.NoError(t, err)
+		value, has, err := stored.Get(ctx, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, value, "nimo")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, len(sent), 1)
+}
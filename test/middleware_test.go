@@ -0,0 +1,104 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	store := &countStore{MemoryStore: sess.NewMemoryStore()}
+	defer store.Close()
+	var handleErr error
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+		Middleware: sess.HubOptionMiddleware{
+			SkipPathPrefixes: []string{"/static/"},
+			OnError: func(writer http.ResponseWriter, request *http.Request, err error) {
+				handleErr = err
+				writer.WriteHeader(http.StatusBadRequest)
+			},
+		},
+	})
+	assert.NoError(t, err)
+	handler := hub.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := request.Context()
+		session, has := sess.FromContext(ctx)
+		if strings.HasPrefix(request.URL.Path, "/static/") {
+			assert.Equal(t, has, false)
+			return
+		}
+		assert.Equal(t, has, true)
+		switch request.URL.Path {
+		case "/set":
+			assert.NoError(t, session.Set(ctx, "name", "nimo"))
+		case "/get":
+			value, _, err := session.Get(ctx, "name")
+			assert.NoError(t, err)
+			_, _ = writer.Write([]byte(value))
+		}
+	}))
+	setWriter := httptest.NewRecorder()
+	handler.ServeHTTP(setWriter, httptest.NewRequest("GET", "/set", nil))
+	assert.Equal(t, setWriter.Code, http.StatusOK)
+	{
+		writer := httptest.NewRecorder()
+		request := requestWithCookie(setWriter)
+		request.URL.Path = "/get"
+		handler.ServeHTTP(writer, request)
+		assert.Equal(t, writer.Body.String(), "nimo")
+	}
+	// 跳过的路径不访问 store
+	{
+		count := store.Count()
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, httptest.NewRequest("GET", "/static/app.js", nil))
+		assert.Equal(t, writer.Code, http.StatusOK)
+		assert.Equal(t, store.Count(), count)
+	}
+	// 错误处理
+	{
+		writer := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", "/get", nil)
+		request.AddCookie(&http.Cookie{Name: "session_id", Value: "forged"})
+		handler.ServeHTTP(writer, request)
+		assert.Equal(t, writer.Code, http.StatusBadRequest)
+		assert.Error(t, handleErr)
+	}
+}
+
+func TestMiddlewareHeader(t *testing.T) {
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+		Middleware: sess.HubOptionMiddleware{
+			Transport: sess.MiddlewareTransportHeader,
+		},
+	})
+	assert.NoError(t, err)
+	var sessionID string
+	handler := hub.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		session, has := sess.FromContext(request.Context())
+		assert.Equal(t, has, true)
+		sessionID = session.ID()
+	}))
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, writer.Header().Get("session"), sessionID)
+	// 默认错误处理不暴露错误信息
+	{
+		writer := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("session", "forged")
+		handler.ServeHTTP(writer, request)
+		assert.Equal(t, writer.Code, http.StatusInternalServerError)
+		assert.Equal(t, strings.TrimSpace(writer.Body.String()), http.StatusText(http.StatusInternalServerError))
+	}
+	_, has := sess.FromContext(context.Background())
+	assert.Equal(t, has, false)
+}
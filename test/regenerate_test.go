@@ -0,0 +1,51 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionRegenerate(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:  testSecureKey,
+		Security:   sess.AEADSecurity{},
+		SessionTTL: time.Hour,
+	})
+	assert.NoError(t, err)
+	writer := httptest.NewRecorder()
+	session, err := hub.GetSessionByCookie(ctx, writer, httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	assert.NoError(t, session.Set(ctx, "cart", "apple"))
+	oldSessionID := session.ID()
+	// Session 的副本共享 Regenerate 的结果
+	sessionCopy := session
+
+	loginWriter := httptest.NewRecorder()
+	{
+		session, err := hub.GetSessionByCookie(ctx, loginWriter, requestWithCookie(writer))
+		assert.NoError(t, err)
+		assert.NoError(t, session.Regenerate(ctx))
+		assert.NotEqual(t, session.ID(), oldSessionID)
+		assert.Contains(t, loginWriter.Header().Get("set-cookie"), "session_id="+session.ID())
+		value, has, err := session.Get(ctx, "cart")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, value, "apple")
+	}
+	assert.Equal(t, sessionCopy.ID(), oldSessionID)
+	assert.NoError(t, session.Regenerate(ctx))
+	assert.Equal(t, sessionCopy.ID(), session.ID())
+	// 旧的 sessionID 失效
+	{
+		_, expired, err := hub.GetSessionBySessionID(ctx, oldSessionID)
+		assert.NoError(t, err)
+		assert.Equal(t, expired, true)
+	}
+}
@@ -0,0 +1,232 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRenewPolicy(t *testing.T) {
+	now := time.Now()
+	info := sess.RenewInfo{
+		Remaining:  time.Hour * 3,
+		SessionTTL: time.Hour * 8,
+		CreatedAt:  now.Add(-time.Hour * 5),
+		LastAccess: now.Add(-time.Minute * 5),
+		Now:        now,
+	}
+	assert.Equal(t, sess.RenewNever{}.Renew(info), sess.RenewDecision{})
+	// 3h < 8h * 0.5
+	assert.Equal(t, sess.RenewAtFraction{}.Renew(info), sess.RenewDecision{Renew: true, TTL: time.Hour * 8})
+	// 3h > 8h * 0.25
+	assert.Equal(t, sess.RenewAtFraction{Fraction: 0.25}.Renew(info), sess.RenewDecision{})
+	assert.Equal(t, sess.RenewEvery{Interval: time.Minute * 10}.Renew(info), sess.RenewDecision{})
+	assert.Equal(t, sess.RenewEvery{Interval: time.Minute * 5}.Renew(info), sess.RenewDecision{Renew: true, TTL: time.Hour * 8})
+	{
+		idle := sess.RenewIdleTimeout{IdleTimeout: time.Hour * 4, MaxLifetime: time.Hour * 6}
+		// 续期不超过 MaxLifetime
+		assert.Equal(t, idle.Renew(info), sess.RenewDecision{Renew: true, TTL: time.Hour})
+		idle.MaxLifetime = time.Hour * 5
+		assert.Equal(t, idle.Renew(info), sess.RenewDecision{Expired: true})
+		idle.MaxLifetime = 0
+		idle.IdleTimeout = time.Hour * 3
+		// 剩余有效期大于 IdleTimeout 的 90% 时不续期
+		assert.Equal(t, idle.Renew(info), sess.RenewDecision{})
+	}
+}
+
+func TestHubRenewPolicy(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:   testSecureKey,
+		SessionTTL:  time.Hour,
+		RenewPolicy: sess.RenewEvery{Interval: time.Minute * 10},
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	storeKey := mustStoreKey(t, sessionID)
+	assert.NoError(t, store.RenewTTL(ctx, storeKey, time.Minute*30))
+	// 距离创建不足 10 分钟不续期
+	{
+		_, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		assert.Equal(t, sessionExpired, false)
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, int64(ttl), int64(time.Minute*30))
+		_, has, err := store.Get(ctx, storeKey, "__goclub_session_last_access_time")
+		assert.NoError(t, err)
+		assert.Equal(t, has, false)
+	}
+	// 距离创建超过 10 分钟续期并记录访问时间
+	{
+		setCreateTime(t, store, storeKey, time.Now().Add(-time.Minute*20))
+		_, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		assert.Equal(t, sessionExpired, false)
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Greater(t, int64(ttl), int64(time.Minute*59))
+		_, has, err := store.Get(ctx, storeKey, "__goclub_session_last_access_time")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+	}
+	// 距离上次续期不足 10 分钟不续期
+	{
+		assert.NoError(t, store.RenewTTL(ctx, storeKey, time.Minute*30))
+		_, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, int64(ttl), int64(time.Minute*30))
+	}
+}
+
+func TestHubRenewIdleTimeout(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:   testSecureKey,
+		SessionTTL:  time.Minute * 15,
+		RenewPolicy: sess.RenewIdleTimeout{IdleTimeout: time.Minute * 15, MaxLifetime: time.Hour * 8},
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	storeKey := mustStoreKey(t, sessionID)
+	setCreateTime(t, store, storeKey, time.Now().Add(-time.Hour*9))
+	_, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, sessionExpired, true)
+	existed, err := store.StoreKeyExists(ctx, storeKey)
+	assert.NoError(t, err)
+	assert.Equal(t, existed, false)
+}
+
+// TestHubRenewIdleTimeoutSessionTTL SessionTTL 大于 IdleTimeout 时有效期不超过 IdleTimeout
+func TestHubRenewIdleTimeoutSessionTTL(t *testing.T) {
+	ctx := context.Background()
+	store := &touchCountStore{MemoryStore: sess.NewMemoryStore()}
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:   testSecureKey,
+		SessionTTL:  time.Hour * 8,
+		RenewPolicy: sess.RenewIdleTimeout{IdleTimeout: time.Minute * 15, MaxLifetime: time.Hour * 8},
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	storeKey := mustStoreKey(t, sessionID)
+	// 创建 session 时有效期不超过 IdleTimeout
+	{
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, int64(ttl), int64(time.Minute*15))
+	}
+	// 续期后有效期为 IdleTimeout 而不是 SessionTTL
+	{
+		assert.NoError(t, store.RenewTTL(ctx, storeKey, time.Minute*5))
+		_, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		assert.Equal(t, sessionExpired, false)
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, int64(ttl), int64(time.Minute*15))
+		assert.Greater(t, int64(ttl), int64(time.Minute*14))
+		// 使用 Touch 续期
+		assert.Equal(t, atomic.LoadInt64(&store.touch), int64(1))
+	}
+	// 续期不超过 MaxLifetime
+	{
+		setCreateTime(t, store, storeKey, time.Now().Add(-time.Hour*8+time.Minute*5))
+		assert.NoError(t, store.RenewTTL(ctx, storeKey, time.Minute))
+		_, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+		assert.NoError(t, err)
+		assert.Equal(t, sessionExpired, false)
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, int64(ttl), int64(time.Minute*5))
+		assert.Greater(t, int64(ttl), int64(time.Minute*3))
+	}
+}
+
+func TestHubRenewIdleTimeoutInvalid(t *testing.T) {
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	_, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:   testSecureKey,
+		RenewPolicy: sess.RenewIdleTimeout{},
+	})
+	assert.Error(t, err)
+}
+
+// destroyOnRenewStore 在 RenewTTL 之前销毁 session，模拟续期期间 session 被另一个请求销毁
+type destroyOnRenewStore struct {
+	sess.Store
+}
+
+func (s destroyOnRenewStore) RenewTTL(ctx context.Context, storeKey string, ttl time.Duration) (err error) {
+	err = s.Store.Destroy(ctx, storeKey)
+	if err != nil {
+		return
+	}
+	return s.Store.RenewTTL(ctx, storeKey, ttl)
+}
+
+// TestHubRenewDestroyed Store 未实现 StoreToucher 时，续期期间 session 被销毁不会重新创建 key
+func TestHubRenewDestroyed(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := sess.NewMemoryStore()
+	defer memoryStore.Close()
+	hub, err := sess.NewHub(destroyOnRenewStore{Store: memoryStore}, sess.HubOption{
+		SecureKey:   testSecureKey,
+		SessionTTL:  time.Hour,
+		RenewPolicy: sess.RenewEvery{Interval: time.Minute * 10},
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	storeKey := mustStoreKey(t, sessionID)
+	setCreateTime(t, memoryStore, storeKey, time.Now().Add(-time.Minute*20))
+	_, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, sessionExpired, true)
+	existed, err := memoryStore.StoreKeyExists(ctx, storeKey)
+	assert.NoError(t, err)
+	assert.Equal(t, existed, false)
+}
+
+// zeroTTLRenewPolicy 续期但没有设置 TTL 的自定义策略
+type zeroTTLRenewPolicy struct{}
+
+func (zeroTTLRenewPolicy) Renew(info sess.RenewInfo) (decision sess.RenewDecision) {
+	return sess.RenewDecision{Renew: true}
+}
+
+// TestHubRenewPolicyInvalidTTL 自定义策略续期时 TTL 不大于 0 返回错误，且不会修改 session
+func TestHubRenewPolicyInvalidTTL(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:   testSecureKey,
+		SessionTTL:  time.Hour,
+		RenewPolicy: zeroTTLRenewPolicy{},
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	storeKey := mustStoreKey(t, sessionID)
+	_, _, err = hub.GetSessionBySessionID(ctx, sessionID)
+	assert.EqualError(t, err, "goclub/session: RenewPolicy returned RenewDecision{Renew: true} but TTL is not greater than 0")
+	ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+	assert.NoError(t, err)
+	assert.Greater(t, int64(ttl), int64(time.Minute*59))
+}
@@ -0,0 +1,131 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var testSecureKey = []byte("e9a2f9cbfab74abaa472ff7385dd8224")
+
+func TestAEADSecurity(t *testing.T) {
+	security := sess.AEADSecurity{}
+	storeKey := []byte(newStoreKey())
+	sessionID, err := security.Encrypt(storeKey, testSecureKey)
+	assert.NoError(t, err)
+	// 每次加密使用随机 nonce
+	{
+		otherSessionID, err := security.Encrypt(storeKey, testSecureKey)
+		assert.NoError(t, err)
+		assert.NotEqual(t, string(sessionID), string(otherSessionID))
+	}
+	{
+		decrypted, err := security.Decrypt(sessionID, testSecureKey)
+		assert.NoError(t, err)
+		assert.Equal(t, string(decrypted), string(storeKey))
+	}
+	// 篡改后认证失败
+	{
+		tampered := []byte(string(sessionID))
+		if tampered[20] == 'A' {
+			tampered[20] = 'B'
+		} else {
+			tampered[20] = 'A'
+		}
+		_, err := security.Decrypt(tampered, testSecureKey)
+		assert.Equal(t, err, sess.ErrInvalidSessionID)
+	}
+	// 秘钥错误
+	{
+		_, err := security.Decrypt(sessionID, []byte("00000000000000000000000000000000"))
+		assert.Equal(t, err, sess.ErrInvalidSessionID)
+	}
+}
+
+func TestSecurityPointerKeyLength(t *testing.T) {
+	store := sess.NewMemoryStore()
+	securities := []sess.Security{&sess.DefaultSecurity{}, &sess.AEADSecurity{}}
+	for _, security := range securities {
+		_, err := sess.NewHub(store, sess.HubOption{
+			SecureKey: []byte("short"),
+			Security:  security,
+		})
+		assert.EqualError(t, err, "goclub/sesison:  NewHub(store, option) option.SecureKey length must be 32")
+	}
+}
+
+func TestAEADSecurityLegacy(t *testing.T) {
+	storeKey := []byte(newStoreKey())
+	legacySessionID, err := sess.DefaultSecurity{}.Encrypt(storeKey, testSecureKey)
+	assert.NoError(t, err)
+	{
+		_, err := sess.AEADSecurity{}.Decrypt(legacySessionID, testSecureKey)
+		assert.Equal(t, err, sess.ErrInvalidSessionID)
+	}
+	{
+		decrypted, err := sess.AEADSecurity{Legacy: sess.DefaultSecurity{}}.Decrypt(legacySessionID, testSecureKey)
+		assert.NoError(t, err)
+		assert.Equal(t, string(decrypted), string(storeKey))
+	}
+}
+
+func TestAEADSecurityCookie(t *testing.T) {
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	TestCookie(t, store, sess.HubOption{
+		SecureKey: testSecureKey,
+		Cookie: sess.HubOptionCookie{
+			Name: "project_name_session_cookie",
+		},
+		Security:   sess.AEADSecurity{},
+		SessionTTL: time.Hour,
+	})
+}
+
+func TestAEADSecurityLegacyReissue(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	legacyHub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+		Security:  sess.DefaultSecurity{},
+	})
+	assert.NoError(t, err)
+	legacyRecorder := httptest.NewRecorder()
+	legacySession, err := legacyHub.GetSessionByCookie(ctx, legacyRecorder, httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	assert.NoError(t, legacySession.Set(ctx, "name", "nimo"))
+	// 迁移到 AEADSecurity 后旧的 sessionID 会以 AEAD 重新签发
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+		Security:  sess.AEADSecurity{Legacy: sess.DefaultSecurity{}},
+	})
+	assert.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	session, err := hub.GetSessionByCookie(ctx, recorder, requestWithCookie(legacyRecorder))
+	assert.NoError(t, err)
+	assert.NotEqual(t, session.ID(), legacySession.ID())
+	value, _, err := session.Get(ctx, "name")
+	assert.NoError(t, err)
+	assert.Equal(t, value, "nimo")
+	cookies := recorder.Result().Cookies()
+	assert.Equal(t, len(cookies), 1)
+	assert.Equal(t, cookies[0].Value, session.ID())
+	// 重新签发的 sessionID 不需要 Legacy 也可以解密
+	aeadHub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+		Security:  sess.AEADSecurity{},
+	})
+	assert.NoError(t, err)
+	_, sessionExpired, err := aeadHub.GetSessionBySessionID(ctx, session.ID())
+	assert.NoError(t, err)
+	assert.Equal(t, sessionExpired, false)
+	// 使用新的 sessionID 请求时不再重新签发
+	nextRecorder := httptest.NewRecorder()
+	_, err = hub.GetSessionByCookie(ctx, nextRecorder, requestWithCookie(recorder))
+	assert.NoError(t, err)
+	assert.Equal(t, len(nextRecorder.Result().Cookies()), 0)
+}
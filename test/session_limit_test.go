@@ -0,0 +1,201 @@
+package testSess
+
+import (
+	"context"
+	xerr "github.com/goclub/error"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newLimitHub(t *testing.T, store sess.Store, max int, policy sess.SessionLimitPolicy) *sess.Hub {
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:          testSecureKey,
+		MaxSessionsPerUser: max,
+		SessionLimitPolicy: policy,
+	})
+	assert.NoError(t, err)
+	return hub
+}
+
+// cookieLogin 创建 session 并绑定用户，返回的 recorder 可以通过 requestWithCookie 继续请求
+func cookieLogin(t *testing.T, hub *sess.Hub, userID string) (recorder *httptest.ResponseRecorder, session sess.Session, err error) {
+	ctx := context.Background()
+	recorder = httptest.NewRecorder()
+	session, err = hub.GetSessionByCookie(ctx, recorder, httptest.NewRequest("POST", "/login", nil))
+	assert.NoError(t, err)
+	err = session.BindUser(ctx, userID)
+	return
+}
+
+func TestMaxSessionsPerUserEvictOldest(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub := newLimitHub(t, store, 1, sess.SessionLimitEvictOldest)
+	phoneRecorder, phone, err := cookieLogin(t, hub, "1")
+	assert.NoError(t, err)
+	// 重复绑定当前 session 不会踢出自己
+	assert.NoError(t, phone.BindUser(ctx, "1"))
+	_, laptop, err := cookieLogin(t, hub, "1")
+	assert.NoError(t, err)
+	sessions, err := hub.ListUserSessions(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, len(sessions), 1)
+	assert.Equal(t, sessions[0].StoreKey, mustStoreKey(t, laptop.ID()))
+	// 被踢出的 session 返回原因并清除 cookie
+	recorder := httptest.NewRecorder()
+	_, err = hub.GetSessionByCookie(ctx, recorder, requestWithCookie(phoneRecorder))
+	evictedErr, asEvictedError := sess.AsSessionEvictedError(err)
+	assert.Equal(t, asEvictedError, true)
+	assert.Equal(t, evictedErr.Reason, sess.EvictReasonLoggedInElsewhere)
+	cookies := recorder.Result().Cookies()
+	assert.Equal(t, len(cookies), 1)
+	assert.Equal(t, cookies[0].MaxAge, -1)
+	// 原因只返回一次，之后获得新的 session
+	session, err := hub.GetSessionByCookie(ctx, httptest.NewRecorder(), requestWithCookie(phoneRecorder))
+	assert.NoError(t, err)
+	assert.NotEqual(t, session.ID(), phone.ID())
+	// 其他用户不受影响
+	_, _, err = cookieLogin(t, hub, "2")
+	assert.NoError(t, err)
+	_, sessionExpired, err := hub.GetSessionBySessionID(ctx, laptop.ID())
+	assert.NoError(t, err)
+	assert.Equal(t, sessionExpired, false)
+}
+
+func TestMaxSessionsPerUserEvictMultiple(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub := newLimitHub(t, store, 2, sess.SessionLimitEvictOldest)
+	var sessionIDs []string
+	for i := 0; i < 4; i++ {
+		_, session, err := cookieLogin(t, hub, "1")
+		assert.NoError(t, err)
+		sessionIDs = append(sessionIDs, session.ID())
+	}
+	sessions, err := hub.ListUserSessions(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, len(sessions), 2)
+	for i, sessionID := range sessionIDs {
+		_, _, err := hub.GetSessionBySessionID(ctx, sessionID)
+		_, asEvictedError := sess.AsSessionEvictedError(err)
+		assert.Equal(t, asEvictedError, i < 2)
+	}
+}
+
+func TestMaxSessionsPerUserRejectNewLogin(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub := newLimitHub(t, store, 1, sess.SessionLimitRejectNewLogin)
+	_, phone, err := cookieLogin(t, hub, "1")
+	assert.NoError(t, err)
+	assert.NoError(t, phone.BindUser(ctx, "1"))
+	_, laptop, err := cookieLogin(t, hub, "1")
+	assert.Equal(t, xerr.Is(err, sess.ErrSessionLimitExceeded), true)
+	_, has, err := laptop.UserID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, has, false)
+	_, sessionExpired, err := hub.GetSessionBySessionID(ctx, phone.ID())
+	assert.NoError(t, err)
+	assert.Equal(t, sessionExpired, false)
+	// 退出后可以登录
+	assert.NoError(t, phone.Destroy(ctx))
+	assert.NoError(t, laptop.BindUser(ctx, "1"))
+}
+
+func TestMaxSessionsPerUserMiddleware(t *testing.T) {
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub := newLimitHub(t, store, 1, sess.SessionLimitEvictOldest)
+	phoneRecorder, _, err := cookieLogin(t, hub, "1")
+	assert.NoError(t, err)
+	_, _, err = cookieLogin(t, hub, "1")
+	assert.NoError(t, err)
+	handler := hub.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, requestWithCookie(phoneRecorder))
+	assert.Equal(t, recorder.Code, http.StatusUnauthorized)
+}
+
+func TestMaxSessionsPerUserOption(t *testing.T) {
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	_, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:          testSecureKey,
+		MaxSessionsPerUser: -1,
+	})
+	assert.Error(t, err)
+	_, err = sess.NewHub(plainStore{store}, sess.HubOption{
+		SecureKey:          testSecureKey,
+		MaxSessionsPerUser: 1,
+	})
+	assert.Error(t, err)
+}
+
+// TestMaxSessionsPerUserWatch 被踢出的 session 结束观察，KeepAlive 不会让它一直存在
+func TestMaxSessionsPerUserWatch(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub := newLimitHub(t, store, 1, sess.SessionLimitEvictOldest)
+	_, phone, err := cookieLogin(t, hub, "1")
+	assert.NoError(t, err)
+	for _, keepAlive := range []bool{false, true} {
+		watcher, err := phone.Watch(ctx, sess.SessionWatcherOption{
+			Interval:  time.Millisecond * 20,
+			KeepAlive: keepAlive,
+		})
+		assert.NoError(t, err)
+		if keepAlive == false {
+			_, _, err = cookieLogin(t, hub, "1")
+			assert.NoError(t, err)
+		}
+		waitWatcher(t, watcher, time.Second)
+		evictedErr, asEvictedError := sess.AsSessionEvictedError(watcher.Err())
+		assert.Equal(t, asEvictedError, true)
+		assert.Equal(t, evictedErr.Reason, sess.EvictReasonLoggedInElsewhere)
+		watcher.Stop()
+	}
+}
+
+// TestMaxSessionsPerUserSingleRoundTrip Store 实现了 StoreToucher 时通过 Touch 检查是否被踢出，不需要额外读取
+// 被踢出的 session 不会被续期
+func TestMaxSessionsPerUserSingleRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := &countStore{MemoryStore: sess.NewMemoryStore()}
+	defer store.Close()
+	hub := newLimitHub(t, store, 1, sess.SessionLimitEvictOldest)
+	_, phone, err := cookieLogin(t, hub, "1")
+	assert.NoError(t, err)
+	count := store.Count()
+	_, sessionExpired, err := hub.GetSessionBySessionID(ctx, phone.ID())
+	assert.NoError(t, err)
+	assert.Equal(t, sessionExpired, false)
+	assert.Equal(t, store.Count(), count)
+	// 被踢出后 KeepAlive 不会续期
+	_, _, err = cookieLogin(t, hub, "1")
+	assert.NoError(t, err)
+	storeKey := mustStoreKey(t, phone.ID())
+	assert.NoError(t, store.RenewTTL(ctx, storeKey, time.Minute))
+	watcher, err := phone.Watch(ctx, sess.SessionWatcherOption{
+		Interval:  time.Millisecond * 20,
+		KeepAlive: true,
+	})
+	assert.NoError(t, err)
+	waitWatcher(t, watcher, time.Second)
+	_, asEvictedError := sess.AsSessionEvictedError(watcher.Err())
+	assert.Equal(t, asEvictedError, true)
+	watcher.Stop()
+	ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, int64(ttl), int64(time.Minute))
+	_, has, err := store.MemoryStore.Get(ctx, storeKey, "__goclub_session_last_access_time")
+	assert.NoError(t, err)
+	assert.Equal(t, has, false)
+}
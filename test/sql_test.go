@@ -0,0 +1,263 @@
+package testSess
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	sess "github.com/goclub/session"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const sqliteSessionSchema = `
+CREATE TABLE goclub_session (
+    store_key  VARCHAR(64)  NOT NULL,
+    field      VARCHAR(255) NOT NULL,
+    value      TEXT         NOT NULL,
+    expires_at BIGINT       NOT NULL,
+    PRIMARY KEY (store_key, field)
+);
+CREATE INDEX idx_goclub_session_expires_at ON goclub_session (expires_at);`
+
+func newSQLiteDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", "file:"+t.TempDir()+"/session.db?_busy_timeout=5000")
+	assert.NoError(t, err)
+	// sqlite 同一时间只允许一个写入
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	_, err = db.Exec(sqliteSessionSchema)
+	assert.NoError(t, err)
+	return db
+}
+
+func newSQLiteStore(t *testing.T, option sess.SQLStoreOption) *sess.SQLStore {
+	option.DB = newSQLiteDB(t)
+	if option.Dialect == nil {
+		option.Dialect = sess.SQLDialectSQLite{}
+	}
+	store, err := sess.NewSQLStore(option)
+	assert.NoError(t, err)
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestSQLStoreSuite(t *testing.T) {
+	RunStoreSuite(t, func() sess.Store {
+		return newSQLiteStore(t, sess.SQLStoreOption{})
+	})
+}
+
+func TestSQLStoreUpsert(t *testing.T) {
+	ctx := context.Background()
+	store := newSQLiteStore(t, sess.SQLStoreOption{})
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	// 并发写入同一个 field 不会主键冲突
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, store.Set(ctx, storeKey, "count", strconv.Itoa(i)))
+		}(i)
+	}
+	wg.Wait()
+	_, hasValue, err := store.Get(ctx, storeKey, "count")
+	assert.NoError(t, err)
+	assert.Equal(t, hasValue, true)
+	// 覆盖写入保留 hash 的有效期
+	assert.NoError(t, store.Set(ctx, storeKey, "count", "last"))
+	value, _, err := store.Get(ctx, storeKey, "count")
+	assert.NoError(t, err)
+	assert.Equal(t, value, "last")
+	ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+	assert.NoError(t, err)
+	assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+}
+
+func TestSQLStoreSweeper(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	var sweepErr error
+	var mu sync.Mutex
+	store, err := sess.NewSQLStore(sess.SQLStoreOption{
+		DB:            db,
+		Dialect:       sess.SQLDialectSQLite{},
+		SweepInterval: time.Millisecond * 20,
+		OnSweepError: func(err error) {
+			mu.Lock()
+			sweepErr = err
+			mu.Unlock()
+		},
+	})
+	assert.NoError(t, err)
+	defer store.Close()
+	expiredKey, aliveKey := newStoreKey(), newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, expiredKey, time.Millisecond*50))
+	assert.NoError(t, store.Set(ctx, expiredKey, "name", "nimo"))
+	assert.NoError(t, store.InitSession(ctx, aliveKey, time.Hour))
+	countRows := func(storeKey string) (count int) {
+		err := db.QueryRow(`SELECT COUNT(*) FROM goclub_session WHERE store_key = ?`, storeKey).Scan(&count)
+		assert.NoError(t, err)
+		return
+	}
+	assert.Equal(t, countRows(expiredKey), 2)
+	time.Sleep(time.Millisecond * 200)
+	// 过期的行被后台删除，未过期的行不受影响
+	assert.Equal(t, countRows(expiredKey), 0)
+	assert.Equal(t, countRows(aliveKey), 1)
+	mu.Lock()
+	assert.NoError(t, sweepErr)
+	mu.Unlock()
+}
+
+// numberedDialect 使用 sqlite 的 ?NNN 占位符并记录每条语句的占位符序号
+type numberedDialect struct {
+	sess.SQLDialectSQLite
+	mu      *sync.Mutex
+	indexes *[]int
+}
+
+func (d numberedDialect) Placeholder(index int) string {
+	d.mu.Lock()
+	*d.indexes = append(*d.indexes, index)
+	d.mu.Unlock()
+	return "?" + strconv.Itoa(index)
+}
+
+func TestSQLStoreDialectPlaceholder(t *testing.T) {
+	ctx := context.Background()
+	// sqlite 支持 $1 风格的参数，可以用来验证 SQLDialectPostgreSQL 的占位符改写
+	for _, dialect := range []sess.SQLDialect{
+		sess.SQLDialectPostgreSQL{},
+		numberedDialect{mu: &sync.Mutex{}, indexes: &[]int{}},
+	} {
+		store := newSQLiteStore(t, sess.SQLStoreOption{Dialect: dialect})
+		storeKey := newStoreKey()
+		assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+		assert.NoError(t, store.Set(ctx, storeKey, "name", "nimo"))
+		assert.NoError(t, store.Set(ctx, storeKey, "name", "nico"))
+		value, hasValue, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, hasValue, true)
+		assert.Equal(t, value, "nico")
+		renamed, err := store.Rename(ctx, storeKey, newStoreKey())
+		assert.NoError(t, err)
+		assert.Equal(t, renamed, true)
+	}
+	// 每条语句的占位符序号从 1 开始递增
+	indexes := &[]int{}
+	store := newSQLiteStore(t, sess.SQLStoreOption{
+		Dialect:       numberedDialect{mu: &sync.Mutex{}, indexes: indexes},
+		SweepInterval: -1,
+	})
+	_, _, err := store.Get(ctx, newStoreKey(), "name")
+	assert.NoError(t, err)
+	assert.Equal(t, *indexes, []int{1, 2, 3})
+}
+
+// recordConnector 记录执行的 sql 语句，用于在没有 mysql 的环境中验证 SQLDialectMySQL 生成的语句
+type recordConnector struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (c *recordConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return recordConn{connector: c}, nil
+}
+func (c *recordConnector) Driver() driver.Driver {
+	return nil
+}
+func (c *recordConnector) record(query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries = append(c.queries, query)
+}
+
+type recordConn struct {
+	connector *recordConnector
+}
+
+func (c recordConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("recordConn: prepare is not supported")
+}
+func (c recordConn) Close() error {
+	return nil
+}
+func (c recordConn) Begin() (driver.Tx, error) {
+	return recordTx{}, nil
+}
+func (c recordConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.connector.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+// QueryContext 返回一行 NULL，与没有数据时 SELECT MAX(expires_at) 的结果一致
+func (c recordConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.connector.record(query)
+	return &recordRows{}, nil
+}
+
+type recordTx struct{}
+
+func (recordTx) Commit() error   { return nil }
+func (recordTx) Rollback() error { return nil }
+
+type recordRows struct {
+	done bool
+}
+
+func (r *recordRows) Columns() []string {
+	return []string{"value"}
+}
+func (r *recordRows) Close() error {
+	return nil
+}
+func (r *recordRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = nil
+	return nil
+}
+
+// TestSQLDialectStatements 验证 MySQL 和 PostgreSQL 的 upsert 语句
+func TestSQLDialectStatements(t *testing.T) {
+	ctx := context.Background()
+	for _, item := range []struct {
+		dialect sess.SQLDialect
+		upsert  string
+	}{
+		{
+			sess.SQLDialectMySQL{},
+			"INSERT INTO goclub_session (store_key, field, value, expires_at) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE value = VALUES(value), expires_at = VALUES(expires_at)",
+		},
+		{
+			sess.SQLDialectPostgreSQL{},
+			"INSERT INTO goclub_session (store_key, field, value, expires_at) VALUES ($1, $2, $3, $4) ON CONFLICT (store_key, field) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at",
+		},
+	} {
+		connector := &recordConnector{}
+		db := sql.OpenDB(connector)
+		store, err := sess.NewSQLStore(sess.SQLStoreOption{
+			DB:            db,
+			Dialect:       item.dialect,
+			SweepInterval: -1,
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, store.Set(ctx, newStoreKey(), "name", "nimo"))
+		connector.mu.Lock()
+		assert.Contains(t, connector.queries, item.upsert)
+		connector.mu.Unlock()
+		assert.NoError(t, db.Close())
+	}
+}
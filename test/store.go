@@ -0,0 +1,717 @@
+package testSess
+
+import (
+	"context"
+	"encoding/json"
+	sess "github.com/goclub/session"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// RunStoreSuite 验证 Store 的实现是否与 sess.RedisStore 行为一致
+// 自定义 Store 时应当在单元测试中调用 RunStoreSuite
+// newStore 会在每个子测试开始时调用一次，Store 实现了 Close() 或 Close() error 时会在子测试结束后关闭
+func RunStoreSuite(t *testing.T, newStore func() sess.Store) {
+	open := func(t *testing.T) sess.Store {
+		store := newStore()
+		t.Cleanup(func() {
+			closeStore(store)
+		})
+		return store
+	}
+	t.Run("InitSession", func(t *testing.T) {
+		storeInitSession(t, open(t))
+	})
+	t.Run("TTLExpire", func(t *testing.T) {
+		storeTTLExpire(t, open(t))
+	})
+	t.Run("RenewTTL", func(t *testing.T) {
+		storeRenewTTL(t, open(t))
+	})
+	t.Run("GetMissing", func(t *testing.T) {
+		storeGetMissing(t, open(t))
+	})
+	t.Run("SetGetDelete", func(t *testing.T) {
+		storeSetGetDelete(t, open(t))
+	})
+	t.Run("Destroy", func(t *testing.T) {
+		storeDestroy(t, open(t))
+	})
+	t.Run("Concurrency", func(t *testing.T) {
+		storeConcurrency(t, open(t))
+	})
+	t.Run("LargeValue", func(t *testing.T) {
+		storeLargeValue(t, open(t))
+	})
+	// 以下为可选能力，Store 实现了对应接口时才会测试
+	probe := open(t)
+	if _, ok := probe.(sess.StoreRenamer); ok {
+		t.Run("Rename", func(t *testing.T) {
+			storeRename(t, open(t).(sess.StoreRenamer))
+		})
+	}
+	if _, ok := probe.(sess.BulkStore); ok {
+		t.Run("Bulk", func(t *testing.T) {
+			storeBulk(t, open(t).(sess.BulkStore))
+		})
+	}
+	if _, ok := probe.(sess.StoreToucher); ok {
+		t.Run("Touch", func(t *testing.T) {
+			storeTouch(t, open(t).(sess.StoreToucher))
+		})
+	}
+	if _, ok := probe.(sess.StoreGetDeleter); ok {
+		t.Run("GetDelete", func(t *testing.T) {
+			storeGetDelete(t, open(t).(sess.StoreGetDeleter))
+		})
+	}
+	if _, ok := probe.(sess.StoreAppender); ok {
+		t.Run("Append", func(t *testing.T) {
+			storeAppend(t, open(t).(sess.StoreAppender))
+		})
+	}
+	if _, ok := probe.(sess.StoreUserIndexer); ok {
+		t.Run("UserIndex", func(t *testing.T) {
+			storeUserIndex(t, open(t).(sess.StoreUserIndexer))
+		})
+	}
+}
+
+// closeStore 关闭 Store 的后台 goroutine 和连接，例如 sess.MemoryStore 的清理 goroutine
+func closeStore(store sess.Store) {
+	switch v := store.(type) {
+	case interface{ Close() error }:
+		_ = v.Close()
+	case interface{ Close() }:
+		v.Close()
+	}
+}
+
+func newStoreKey() string {
+	return uuid.New().String()
+}
+
+func storeInitSession(t *testing.T, store sess.Store) {
+	ctx := context.Background()
+	storeKey := newStoreKey()
+	{
+		existed, err := store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+	}
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	{
+		existed, err := store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, true)
+	}
+	{
+		value, has, err := store.Get(ctx, storeKey, "__goclub_session_create_time")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		unix, err := strconv.ParseInt(value, 10, 64)
+		assert.NoError(t, err)
+		assert.InDelta(t, time.Now().Unix(), unix, 5)
+	}
+	{
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+		assert.LessOrEqual(t, int64(ttl), int64(time.Hour))
+	}
+}
+
+func storeTTLExpire(t *testing.T, store sess.Store) {
+	ctx := context.Background()
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Millisecond*200))
+	assert.NoError(t, store.Set(ctx, storeKey, "name", "nimo"))
+	time.Sleep(time.Millisecond * 400)
+	{
+		existed, err := store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+	}
+	{
+		value, has, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "")
+		assert.Equal(t, has, false)
+	}
+	{
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, ttl, time.Duration(0))
+	}
+}
+
+func storeRenewTTL(t *testing.T, store sess.Store) {
+	ctx := context.Background()
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Millisecond*200))
+	assert.NoError(t, store.RenewTTL(ctx, storeKey, time.Hour))
+	time.Sleep(time.Millisecond * 400)
+	{
+		existed, err := store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, true)
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+	}
+	// key 不存在时 RenewTTL 不会创建 key
+	missingKey := newStoreKey()
+	assert.NoError(t, store.RenewTTL(ctx, missingKey, time.Hour))
+	{
+		existed, err := store.StoreKeyExists(ctx, missingKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+	}
+}
+
+func storeGetMissing(t *testing.T, store sess.Store) {
+	ctx := context.Background()
+	storeKey := newStoreKey()
+	// key 不存在
+	{
+		value, has, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "")
+		assert.Equal(t, has, false)
+	}
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	// key 存在但 field 不存在
+	{
+		value, has, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "")
+		assert.Equal(t, has, false)
+	}
+	// 空字符串也是值
+	assert.NoError(t, store.Set(ctx, storeKey, "name", ""))
+	{
+		value, has, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "")
+		assert.Equal(t, has, true)
+	}
+}
+
+func storeSetGetDelete(t *testing.T, store sess.Store) {
+	ctx := context.Background()
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	assert.NoError(t, store.Set(ctx, storeKey, "name", "nimo"))
+	assert.NoError(t, store.Set(ctx, storeKey, "name", "nico"))
+	{
+		value, has, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "nico")
+		assert.Equal(t, has, true)
+	}
+	assert.NoError(t, store.Delete(ctx, storeKey, "name"))
+	{
+		value, has, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "")
+		assert.Equal(t, has, false)
+	}
+	// 删除不存在的 field 和不存在的 key 都不返回错误
+	assert.NoError(t, store.Delete(ctx, storeKey, "name"))
+	assert.NoError(t, store.Delete(ctx, newStoreKey(), "name"))
+	// Delete 不影响其他 field 和 ttl
+	{
+		existed, err := store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, true)
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+	}
+}
+
+func storeDestroy(t *testing.T, store sess.Store) {
+	ctx := context.Background()
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	assert.NoError(t, store.Set(ctx, storeKey, "name", "nimo"))
+	assert.NoError(t, store.Destroy(ctx, storeKey))
+	{
+		existed, err := store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+		value, has, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, value, "")
+		assert.Equal(t, has, false)
+	}
+	// 重复 Destroy 和 Destroy 不存在的 key 都不返回错误
+	assert.NoError(t, store.Destroy(ctx, storeKey))
+	assert.NoError(t, store.Destroy(ctx, newStoreKey()))
+}
+
+func storeConcurrency(t *testing.T, store sess.Store) {
+	ctx := context.Background()
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	count := 50
+	wg := sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			field := "field_" + strconv.Itoa(i)
+			assert.NoError(t, store.Set(ctx, storeKey, field, strconv.Itoa(i)))
+			value, has, err := store.Get(ctx, storeKey, field)
+			assert.NoError(t, err)
+			assert.Equal(t, has, true)
+			assert.Equal(t, value, strconv.Itoa(i))
+			assert.NoError(t, store.RenewTTL(ctx, storeKey, time.Hour))
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < count; i++ {
+		value, has, err := store.Get(ctx, storeKey, "field_"+strconv.Itoa(i))
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, value, strconv.Itoa(i))
+	}
+}
+
+func storeLargeValue(t *testing.T, store sess.Store) {
+	ctx := context.Background()
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	largeValue := strings.Repeat("goclub/session 会话\n", 1024*32)
+	assert.NoError(t, store.Set(ctx, storeKey, "large", largeValue))
+	value, has, err := store.Get(ctx, storeKey, "large")
+	assert.NoError(t, err)
+	assert.Equal(t, has, true)
+	assert.Equal(t, len(value), len(largeValue))
+	assert.Equal(t, value == largeValue, true)
+}
+
+type renamerStore interface {
+	sess.Store
+	sess.StoreRenamer
+}
+
+func storeRename(t *testing.T, renamer sess.StoreRenamer) {
+	ctx := context.Background()
+	store, ok := renamer.(renamerStore)
+	if ok == false {
+		t.Fatal("StoreRenamer must implement sess.Store")
+	}
+	oldStoreKey := newStoreKey()
+	newKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, oldStoreKey, time.Hour))
+	assert.NoError(t, store.Set(ctx, oldStoreKey, "name", "nimo"))
+	renamed, err := store.Rename(ctx, oldStoreKey, newKey)
+	assert.NoError(t, err)
+	assert.Equal(t, renamed, true)
+	{
+		existed, err := store.StoreKeyExists(ctx, oldStoreKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+	}
+	{
+		value, has, err := store.Get(ctx, newKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, value, "nimo")
+		_, has, err = store.Get(ctx, newKey, "__goclub_session_create_time")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		// 保留 ttl
+		ttl, err := store.StoreKeyRemainingTTL(ctx, newKey)
+		assert.NoError(t, err)
+		assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+	}
+	// oldStoreKey 不存在
+	{
+		renamed, err := store.Rename(ctx, newStoreKey(), newStoreKey())
+		assert.NoError(t, err)
+		assert.Equal(t, renamed, false)
+	}
+}
+
+type bulkStore interface {
+	sess.Store
+	sess.BulkStore
+}
+
+func storeBulk(t *testing.T, bulk sess.BulkStore) {
+	ctx := context.Background()
+	store, ok := bulk.(bulkStore)
+	if ok == false {
+		t.Fatal("BulkStore must implement sess.Store")
+	}
+	// key 不存在
+	{
+		values, err := store.GetAll(ctx, newStoreKey())
+		assert.NoError(t, err)
+		assert.Equal(t, len(values), 0)
+	}
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	assert.NoError(t, store.Set(ctx, storeKey, "age", "18"))
+	assert.NoError(t, store.BulkWrite(ctx, storeKey, map[string]string{
+		"name": "nimo",
+		"city": "shanghai",
+	}, []string{"age", "missing"}))
+	{
+		values, err := store.GetAll(ctx, storeKey)
+		assert.NoError(t, err)
+		_, has := values["__goclub_session_create_time"]
+		assert.Equal(t, has, true)
+		delete(values, "__goclub_session_create_time")
+		assert.Equal(t, values, map[string]string{
+			"name": "nimo",
+			"city": "shanghai",
+		})
+		// 保留 ttl
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+	}
+	// 删除所有 field 后 key 不存在
+	{
+		assert.NoError(t, store.BulkWrite(ctx, storeKey, nil, []string{"name", "city", "__goclub_session_create_time"}))
+		existed, err := store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+	}
+}
+
+type toucherStore interface {
+	sess.Store
+	sess.StoreToucher
+}
+
+func storeTouch(t *testing.T, toucher sess.StoreToucher) {
+	ctx := context.Background()
+	store, ok := toucher.(toucherStore)
+	if ok == false {
+		t.Fatal("StoreToucher must implement sess.Store")
+	}
+	// key 不存在
+	{
+		storeKey := newStoreKey()
+		existed, remaining, _, err := store.Touch(ctx, storeKey, time.Hour, time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+		assert.Equal(t, remaining, time.Duration(0))
+		existed, err = store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+	}
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	// 剩余有效期大于 renewThreshold 时不续期
+	{
+		existed, remaining, _, err := store.Touch(ctx, storeKey, time.Hour*2, time.Minute*30)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, true)
+		assert.Greater(t, int64(remaining), int64(time.Hour-time.Minute))
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, int64(ttl), int64(time.Hour))
+	}
+	// 剩余有效期小于 renewThreshold 时续期
+	{
+		existed, remaining, _, err := store.Touch(ctx, storeKey, time.Hour*2, time.Minute*90)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, true)
+		assert.LessOrEqual(t, int64(remaining), int64(time.Hour))
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Greater(t, int64(ttl), int64(time.Hour*2-time.Minute))
+	}
+	// 永不过期的 key 剩余有效期为 0，会被续期
+	{
+		storeKey := newStoreKey()
+		assert.NoError(t, store.Set(ctx, storeKey, "name", "nimo"))
+		existed, remaining, _, err := store.Touch(ctx, storeKey, time.Hour, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, true)
+		assert.Equal(t, remaining, time.Duration(0))
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+	}
+	// RenewWithValues key 不存在时不会创建 key
+	{
+		storeKey := newStoreKey()
+		existed, _, err := store.RenewWithValues(ctx, storeKey, time.Hour, map[string]string{"name": "nimo"})
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+		existed, err = store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+	}
+	// RenewWithValues key 存在时写入并续期
+	{
+		existed, _, err := store.RenewWithValues(ctx, storeKey, time.Hour*3, map[string]string{"name": "nimo", "age": "18"})
+		assert.NoError(t, err)
+		assert.Equal(t, existed, true)
+		value, has, err := store.Get(ctx, storeKey, "age")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, value, "18")
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Greater(t, int64(ttl), int64(time.Hour*3-time.Minute))
+	}
+	// 实现了 StoreUserIndexer 的 Store 可以踢出 session，被踢出的 session 不续期也不写入
+	if _, ok := toucher.(sess.StoreUserIndexer); ok {
+		storeKey := newStoreKey()
+		assert.NoError(t, store.InitSession(ctx, storeKey, time.Minute))
+		assert.NoError(t, store.Set(ctx, storeKey, "__goclub_session_evicted", "logged_in_elsewhere"))
+		existed, _, evictedReason, err := store.Touch(ctx, storeKey, time.Hour, time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, true)
+		assert.Equal(t, evictedReason, "logged_in_elsewhere")
+		existed, evictedReason, err = store.RenewWithValues(ctx, storeKey, time.Hour, map[string]string{"name": "nimo"})
+		assert.NoError(t, err)
+		assert.Equal(t, existed, true)
+		assert.Equal(t, evictedReason, "logged_in_elsewhere")
+		ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, int64(ttl), int64(time.Minute))
+		_, has, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, has, false)
+	}
+}
+
+type appenderStore interface {
+	sess.Store
+	sess.StoreAppender
+}
+
+func storeAppend(t *testing.T, appender sess.StoreAppender) {
+	ctx := context.Background()
+	store, ok := appender.(appenderStore)
+	if ok == false {
+		t.Fatal("StoreAppender must implement sess.Store")
+	}
+	storeKey := newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	assert.NoError(t, store.AppendJSONArray(ctx, storeKey, "list", `"a"`))
+	{
+		value, has, err := store.Get(ctx, storeKey, "list")
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, value, `["a"]`)
+	}
+	// 并发追加不会丢失
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, store.AppendJSONArray(ctx, storeKey, "list", strconv.Itoa(i)))
+		}(i)
+	}
+	wg.Wait()
+	value, has, err := store.Get(ctx, storeKey, "list")
+	assert.NoError(t, err)
+	assert.Equal(t, has, true)
+	var elements []interface{}
+	require.NoError(t, json.Unmarshal([]byte(value), &elements))
+	// 长度不符时停止，避免索引越界导致整个测试 panic
+	require.Len(t, elements, 11)
+	assert.Equal(t, elements[0], "a")
+	// 空数组
+	for _, empty := range []string{`[]`, `[ ]`} {
+		assert.NoError(t, store.Set(ctx, storeKey, "empty", empty))
+		assert.NoError(t, store.AppendJSONArray(ctx, storeKey, "empty", `"b"`))
+		value, _, err := store.Get(ctx, storeKey, "empty")
+		assert.NoError(t, err)
+		assert.Equal(t, value, `["b"]`)
+	}
+	// 不是 json 数组时返回 *sess.DecodeError 且不修改
+	for _, invalid := range []string{`"text"`, `{"a":1}`, `[`} {
+		assert.NoError(t, store.Set(ctx, storeKey, "invalid", invalid))
+		err := store.AppendJSONArray(ctx, storeKey, "invalid", `"b"`)
+		decodeErr, asDecodeError := sess.AsDecodeError(err)
+		assert.Equal(t, asDecodeError, true, invalid)
+		if asDecodeError {
+			assert.Equal(t, decodeErr.Field, "invalid")
+			assert.Equal(t, decodeErr.Value, invalid)
+		}
+		value, _, err := store.Get(ctx, storeKey, "invalid")
+		assert.NoError(t, err)
+		assert.Equal(t, value, invalid)
+	}
+}
+
+type getDeleterStore interface {
+	sess.Store
+	sess.StoreGetDeleter
+}
+
+func storeGetDelete(t *testing.T, getDeleter sess.StoreGetDeleter) {
+	ctx := context.Background()
+	store, ok := getDeleter.(getDeleterStore)
+	if ok == false {
+		t.Fatal("StoreGetDeleter must implement sess.Store")
+	}
+	storeKey := newStoreKey()
+	{
+		_, hasValue, err := store.GetDelete(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, hasValue, false)
+	}
+	assert.NoError(t, store.InitSession(ctx, storeKey, time.Hour))
+	assert.NoError(t, store.Set(ctx, storeKey, "name", "nimo"))
+	// 并发读取时只有一个能读取到
+	var wg sync.WaitGroup
+	var count int64
+	var mu sync.Mutex
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, hasValue, err := store.GetDelete(ctx, storeKey, "name")
+			assert.NoError(t, err)
+			if hasValue {
+				assert.Equal(t, value, "nimo")
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, count, int64(1))
+	{
+		_, hasValue, err := store.Get(ctx, storeKey, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, hasValue, false)
+		// 其他 field 不受影响
+		existed, err := store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, true)
+	}
+}
+
+type userIndexerStore interface {
+	sess.Store
+	sess.StoreUserIndexer
+}
+
+func storeUserIndex(t *testing.T, indexer sess.StoreUserIndexer) {
+	ctx := context.Background()
+	store, ok := indexer.(userIndexerStore)
+	if ok == false {
+		t.Fatal("StoreUserIndexer must implement sess.Store")
+	}
+	userID := uuid.New().String()
+	listStoreKeys := func(userID string) (storeKeys []string) {
+		sessions, err := store.UserSessions(ctx, userID)
+		assert.NoError(t, err)
+		for _, session := range sessions {
+			storeKeys = append(storeKeys, session.StoreKey)
+		}
+		return
+	}
+	{
+		bound, err := store.BindUser(ctx, newStoreKey(), userID, sess.UserSessionMeta{})
+		assert.NoError(t, err)
+		assert.Equal(t, bound, false)
+		assert.Equal(t, len(listStoreKeys(userID)), 0)
+	}
+	key1, key2, shortKey := newStoreKey(), newStoreKey(), newStoreKey()
+	assert.NoError(t, store.InitSession(ctx, key1, time.Hour))
+	assert.NoError(t, store.InitSession(ctx, key2, time.Hour))
+	assert.NoError(t, store.InitSession(ctx, shortKey, time.Millisecond*200))
+	for _, storeKey := range []string{key1, key2, shortKey} {
+		bound, err := store.BindUser(ctx, storeKey, userID, sess.UserSessionMeta{
+			UserAgent: "agent-" + storeKey,
+			IP:        "127.0.0.1",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, bound, true)
+		// 保证绑定时间不同
+		time.Sleep(time.Millisecond * 5)
+	}
+	{
+		sessions, err := store.UserSessions(ctx, userID)
+		assert.NoError(t, err)
+		require.Len(t, sessions, 3)
+		for i, storeKey := range []string{key1, key2, shortKey} {
+			assert.Equal(t, sessions[i].StoreKey, storeKey)
+			assert.Equal(t, sessions[i].UserAgent, "agent-"+storeKey)
+			assert.Equal(t, sessions[i].IP, "127.0.0.1")
+			assert.InDelta(t, time.Now().Unix(), sessions[i].CreatedAt.Unix(), 5)
+			assert.InDelta(t, time.Now().UnixNano(), sessions[i].BoundAt.UnixNano(), float64(time.Second*5))
+		}
+		value, hasValue, err := store.Get(ctx, key1, "__goclub_session_user_id")
+		assert.NoError(t, err)
+		assert.Equal(t, hasValue, true)
+		assert.Equal(t, value, userID)
+	}
+	// 过期的 session 会被清除
+	time.Sleep(time.Millisecond * 300)
+	assert.Equal(t, listStoreKeys(userID), []string{key1, key2})
+	// Destroy 会从索引中移除
+	assert.NoError(t, store.Destroy(ctx, key1))
+	assert.Equal(t, listStoreKeys(userID), []string{key2})
+	// Rename 会更新索引
+	if renamer, ok := indexer.(sess.StoreRenamer); ok {
+		key3 := newStoreKey()
+		renamed, err := renamer.Rename(ctx, key2, key3)
+		assert.NoError(t, err)
+		assert.Equal(t, renamed, true)
+		assert.Equal(t, listStoreKeys(userID), []string{key3})
+		key2 = key3
+	}
+	// 绑定到其他用户时从旧用户的索引中移除
+	otherUserID := uuid.New().String()
+	bound, err := store.BindUser(ctx, key2, otherUserID, sess.UserSessionMeta{})
+	assert.NoError(t, err)
+	assert.Equal(t, bound, true)
+	assert.Equal(t, len(listStoreKeys(userID)), 0)
+	assert.Equal(t, listStoreKeys(otherUserID), []string{key2})
+	// EvictSession 只保留创建时间和写入的字段，剩余有效期不变，同时从索引中移除
+	{
+		assert.NoError(t, store.Set(ctx, key2, "name", "nimo"))
+		createTime, _, err := store.Get(ctx, key2, "__goclub_session_create_time")
+		assert.NoError(t, err)
+		evicted, err := store.EvictSession(ctx, key2, map[string]string{"reason": "test"}, time.Hour*2)
+		assert.NoError(t, err)
+		assert.Equal(t, evicted, true)
+		assert.Equal(t, len(listStoreKeys(otherUserID)), 0)
+		_, hasValue, err := store.Get(ctx, key2, "name")
+		assert.NoError(t, err)
+		assert.Equal(t, hasValue, false)
+		value, hasValue, err := store.Get(ctx, key2, "reason")
+		assert.NoError(t, err)
+		assert.Equal(t, hasValue, true)
+		assert.Equal(t, value, "test")
+		value, _, err = store.Get(ctx, key2, "__goclub_session_create_time")
+		assert.NoError(t, err)
+		assert.Equal(t, value, createTime)
+		ttl, err := store.StoreKeyRemainingTTL(ctx, key2)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, int64(ttl), int64(time.Hour))
+		assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+	}
+	// EvictSession key 不存在时不会创建 key
+	{
+		storeKey := newStoreKey()
+		evicted, err := store.EvictSession(ctx, storeKey, map[string]string{"reason": "test"}, time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, evicted, false)
+		existed, err := store.StoreKeyExists(ctx, storeKey)
+		assert.NoError(t, err)
+		assert.Equal(t, existed, false)
+	}
+}
@@ -0,0 +1,97 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// touchCountStore 记录 Touch 和 StoreKeyExists 被调用的次数
+type touchCountStore struct {
+	*sess.MemoryStore
+	touch  int64
+	exists int64
+}
+
+func (s *touchCountStore) Touch(ctx context.Context, storeKey string, ttl time.Duration, renewThreshold time.Duration) (existed bool, remaining time.Duration, evictedReason string, err error) {
+	atomic.AddInt64(&s.touch, 1)
+	return s.MemoryStore.Touch(ctx, storeKey, ttl, renewThreshold)
+}
+func (s *touchCountStore) StoreKeyExists(ctx context.Context, storeKey string) (existed bool, err error) {
+	atomic.AddInt64(&s.exists, 1)
+	return s.MemoryStore.StoreKeyExists(ctx, storeKey)
+}
+
+func TestHubTouch(t *testing.T) {
+	ctx := context.Background()
+	store := &touchCountStore{MemoryStore: sess.NewMemoryStore()}
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:  testSecureKey,
+		SessionTTL: time.Hour,
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	storeKey := mustStoreKey(t, sessionID)
+	assert.NoError(t, store.RenewTTL(ctx, storeKey, time.Minute))
+	_, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, sessionExpired, false)
+	// 只调用了一次 Touch
+	assert.Equal(t, atomic.LoadInt64(&store.touch), int64(1))
+	assert.Equal(t, atomic.LoadInt64(&store.exists), int64(0))
+	ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+	assert.NoError(t, err)
+	assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+}
+
+// TestHubTouchFallback Store 未实现 StoreToucher 时依次调用 StoreKeyExists StoreKeyRemainingTTL RenewTTL
+func TestHubTouchFallback(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := sess.NewMemoryStore()
+	defer memoryStore.Close()
+	store := plainStore{Store: memoryStore}
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:  testSecureKey,
+		SessionTTL: time.Hour,
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	storeKey := mustStoreKey(t, sessionID)
+	assert.NoError(t, store.RenewTTL(ctx, storeKey, time.Minute))
+	_, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, sessionExpired, false)
+	ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+	assert.NoError(t, err)
+	assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+}
+
+// TestHubTouchAbsoluteTTL 配置 AbsoluteTTL 时仍然使用 Touch 续期
+func TestHubTouchAbsoluteTTL(t *testing.T) {
+	ctx := context.Background()
+	store := &touchCountStore{MemoryStore: sess.NewMemoryStore()}
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:   testSecureKey,
+		SessionTTL:  time.Hour,
+		AbsoluteTTL: time.Hour * 8,
+	})
+	assert.NoError(t, err)
+	sessionID, err := hub.NewSessionID(ctx)
+	assert.NoError(t, err)
+	storeKey := mustStoreKey(t, sessionID)
+	assert.NoError(t, store.RenewTTL(ctx, storeKey, time.Minute))
+	_, sessionExpired, err := hub.GetSessionBySessionID(ctx, sessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, sessionExpired, false)
+	assert.Equal(t, atomic.LoadInt64(&store.touch), int64(1))
+	ttl, err := store.StoreKeyRemainingTTL(ctx, storeKey)
+	assert.NoError(t, err)
+	assert.Greater(t, int64(ttl), int64(time.Hour-time.Minute))
+}
@@ -0,0 +1,124 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+func loginSession(t *testing.T, hub *sess.Hub, userID string, userAgent string) sess.Session {
+	ctx := context.Background()
+	request := httptest.NewRequest("POST", "/login", nil)
+	request.Header.Set("User-Agent", userAgent)
+	request.RemoteAddr = "10.0.0.1:5678"
+	session, err := hub.GetSessionByCookie(ctx, httptest.NewRecorder(), request)
+	assert.NoError(t, err)
+	assert.NoError(t, session.BindUser(ctx, userID))
+	return session
+}
+
+func TestUserSessions(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	phone := loginSession(t, hub, "1", "phone")
+	laptop := loginSession(t, hub, "1", "laptop")
+	tablet := loginSession(t, hub, "1", "tablet")
+	other := loginSession(t, hub, "2", "other")
+	{
+		userID, has, err := phone.UserID(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, has, true)
+		assert.Equal(t, userID, "1")
+	}
+	{
+		sessions, err := hub.ListUserSessions(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, len(sessions), 3)
+		userAgents := map[string]bool{}
+		for _, session := range sessions {
+			userAgents[session.UserAgent] = true
+			assert.Equal(t, session.IP, "10.0.0.1")
+		}
+		assert.Equal(t, userAgents, map[string]bool{"phone": true, "laptop": true, "tablet": true})
+	}
+	// Regenerate 后索引指向新的 storeKey
+	assert.NoError(t, laptop.Regenerate(ctx))
+	// Destroy 会从索引中移除
+	assert.NoError(t, tablet.Destroy(ctx))
+	{
+		sessions, err := hub.ListUserSessions(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, len(sessions), 2)
+	}
+	// 退出其他设备
+	assert.NoError(t, hub.DestroyUserSessions(ctx, "1", laptop.ID()))
+	{
+		sessions, err := hub.ListUserSessions(ctx, "1")
+		assert.NoError(t, err)
+		assert.Equal(t, len(sessions), 1)
+		assert.Equal(t, sessions[0].UserAgent, "laptop")
+		_, sessionExpired, err := hub.GetSessionBySessionID(ctx, phone.ID())
+		assert.NoError(t, err)
+		assert.Equal(t, sessionExpired, true)
+		_, sessionExpired, err = hub.GetSessionBySessionID(ctx, laptop.ID())
+		assert.NoError(t, err)
+		assert.Equal(t, sessionExpired, false)
+	}
+	// 其他用户不受影响
+	{
+		sessions, err := hub.ListUserSessions(ctx, "2")
+		assert.NoError(t, err)
+		assert.Equal(t, len(sessions), 1)
+		_, sessionExpired, err := hub.GetSessionBySessionID(ctx, other.ID())
+		assert.NoError(t, err)
+		assert.Equal(t, sessionExpired, false)
+	}
+}
+
+func TestBindUserRequestCache(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(store, sess.HubOption{
+		SecureKey:    testSecureKey,
+		RequestCache: true,
+		LazySession:  true,
+	})
+	assert.NoError(t, err)
+	session, err := hub.GetSessionByCookie(ctx, httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	// 加载缓存后绑定，缓存中的 userID 也会更新
+	_, _, err = session.Get(ctx, "name")
+	assert.NoError(t, err)
+	assert.NoError(t, session.BindUserWithMeta(ctx, "1", sess.UserSessionMeta{IP: "10.0.0.2"}))
+	userID, has, err := session.UserID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, has, true)
+	assert.Equal(t, userID, "1")
+	sessions, err := hub.ListUserSessions(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, len(sessions), 1)
+	assert.Equal(t, sessions[0].IP, "10.0.0.2")
+}
+
+func TestBindUserWithoutIndexer(t *testing.T) {
+	ctx := context.Background()
+	store := sess.NewMemoryStore()
+	defer store.Close()
+	hub, err := sess.NewHub(plainStore{store}, sess.HubOption{
+		SecureKey: testSecureKey,
+	})
+	assert.NoError(t, err)
+	session, err := hub.GetSessionByCookie(ctx, httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	assert.Error(t, session.BindUser(ctx, "1"))
+	_, err = hub.ListUserSessions(ctx, "1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package testSess
+
+import (
+	"context"
+	sess "github.com/goclub/session"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newWatchSession(t *testing.T, option sess.HubOption) (store *sess.MemoryStore, session sess.Session) {
+	store = sess.NewMemoryStore()
+	option.SecureKey = testSecureKey
+	hub, err := sess.NewHub(store, option)
+	assert.NoError(t, err)
+	session, err = hub.GetSessionByCookie(context.Background(), httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	return store, session
+}
+
+func waitWatcher(t *testing.T, watcher *sess.SessionWatcher, timeout time.Duration) {
+	select {
+	case <-watcher.Done():
+	case <-time.After(timeout):
+		t.Fatal("watcher context should be canceled")
+	}
+}
+
+func TestSessionWatcherDestroy(t *testing.T) {
+	ctx := context.Background()
+	store, session := newWatchSession(t, sess.HubOption{})
+	defer store.Close()
+	watcher, err := session.Watch(ctx, sess.SessionWatcherOption{
+		Interval: time.Millisecond * 20,
+	})
+	assert.NoError(t, err)
+	defer watcher.Stop()
+	time.Sleep(time.Millisecond * 50)
+	assert.NoError(t, watcher.Err())
+	assert.NoError(t, session.Destroy(ctx))
+	waitWatcher(t, watcher, time.Second)
+	assert.Equal(t, watcher.Err(), sess.ErrSessionEnded)
+}
+
+func TestSessionWatcherExpire(t *testing.T) {
+	ctx := context.Background()
+	store, session := newWatchSession(t, sess.HubOption{
+		SessionTTL:  time.Millisecond * 200,
+		RenewPolicy: sess.RenewNever{},
+	})
+	defer store.Close()
+	// Interval 大于剩余有效期时在到期时检查
+	watcher, err := session.Watch(ctx, sess.SessionWatcherOption{
+		Interval: time.Hour,
+	})
+	assert.NoError(t, err)
+	defer watcher.Stop()
+	waitWatcher(t, watcher, time.Second)
+	assert.Equal(t, watcher.Err(), sess.ErrSessionEnded)
+}
+
+func TestSessionWatcherKeepAlive(t *testing.T) {
+	ctx := context.Background()
+	store, session := newWatchSession(t, sess.HubOption{
+		SessionTTL: time.Millisecond * 200,
+	})
+	defer store.Close()
+	// Interval 必须小于续期阈值 SessionTTL * 0.5
+	_, err := session.Watch(ctx, sess.SessionWatcherOption{
+		Interval:  time.Millisecond * 100,
+		KeepAlive: true,
+	})
+	assert.Error(t, err)
+	watcher, err := session.Watch(ctx, sess.SessionWatcherOption{
+		Interval:  time.Millisecond * 50,
+		KeepAlive: true,
+	})
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 500)
+	assert.NoError(t, watcher.Err())
+	_, has, err := session.CreatedAt(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, has, true)
+	watcher.Stop()
+	assert.Equal(t, watcher.Err(), context.Canceled)
+	assert.Error(t, watcher.Context().Err())
+}
+
+func TestSessionWatcherKeepAliveAbsoluteTTL(t *testing.T) {
+	ctx := context.Background()
+	store, session := newWatchSession(t, sess.HubOption{
+		SessionTTL:  time.Millisecond * 200,
+		AbsoluteTTL: time.Hour,
+	})
+	defer store.Close()
+	watcher, err := session.Watch(ctx, sess.SessionWatcherOption{
+		Interval:  time.Millisecond * 20,
+		KeepAlive: true,
+	})
+	assert.NoError(t, err)
+	defer watcher.Stop()
+	time.Sleep(time.Millisecond * 50)
+	assert.NoError(t, watcher.Err())
+	// 超过最长有效期后销毁 session
+	setCreateTime(t, store, mustStoreKey(t, session.ID()), time.Now().Add(-time.Hour*2))
+	waitWatcher(t, watcher, time.Second)
+	assert.Equal(t, watcher.Err(), sess.ErrSessionEnded)
+	_, has, err := session.CreatedAt(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, has, false)
+}
+
+// TestSessionWatcherKeepAliveRenewNever KeepAlive 按照 RenewPolicy 续期，RenewNever 不续期
+func TestSessionWatcherKeepAliveRenewNever(t *testing.T) {
+	ctx := context.Background()
+	store, session := newWatchSession(t, sess.HubOption{
+		SessionTTL:  time.Millisecond * 200,
+		RenewPolicy: sess.RenewNever{},
+	})
+	defer store.Close()
+	watcher, err := session.Watch(ctx, sess.SessionWatcherOption{
+		Interval:  time.Millisecond * 20,
+		KeepAlive: true,
+	})
+	assert.NoError(t, err)
+	defer watcher.Stop()
+	waitWatcher(t, watcher, time.Second)
+	assert.Equal(t, watcher.Err(), sess.ErrSessionEnded)
+}
+
+// TestSessionWatcherKeepAliveMaxLifetime KeepAlive 续期不超过 RenewIdleTimeout{}.MaxLifetime
+func TestSessionWatcherKeepAliveMaxLifetime(t *testing.T) {
+	ctx := context.Background()
+	store, session := newWatchSession(t, sess.HubOption{
+		SessionTTL:  time.Hour,
+		RenewPolicy: sess.RenewIdleTimeout{IdleTimeout: time.Millisecond * 200, MaxLifetime: time.Hour},
+	})
+	defer store.Close()
+	watcher, err := session.Watch(ctx, sess.SessionWatcherOption{
+		Interval:  time.Millisecond * 20,
+		KeepAlive: true,
+	})
+	assert.NoError(t, err)
+	defer watcher.Stop()
+	time.Sleep(time.Millisecond * 300)
+	assert.NoError(t, watcher.Err())
+	setCreateTime(t, store, mustStoreKey(t, session.ID()), time.Now().Add(-time.Hour*2))
+	waitWatcher(t, watcher, time.Second)
+	assert.Equal(t, watcher.Err(), sess.ErrSessionEnded)
+}
+
+func TestSessionWatcherParentCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store, session := newWatchSession(t, sess.HubOption{})
+	defer store.Close()
+	watcher, err := session.Watch(ctx, sess.SessionWatcherOption{})
+	assert.NoError(t, err)
+	defer watcher.Stop()
+	cancel()
+	waitWatcher(t, watcher, time.Second)
+	// 等待后台 goroutine 记录原因
+	watcher.Stop()
+	assert.Equal(t, watcher.Err(), context.Canceled)
+}
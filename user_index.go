@@ -0,0 +1,169 @@
+package sess
+
+import (
+	"context"
+	xerr "github.com/goclub/error"
+	"net"
+	"sort"
+	"time"
+)
+
+// UserSessionMeta session.BindUser() 时记录的设备信息
+type UserSessionMeta struct {
+	UserAgent string
+	IP        string
+}
+
+// UserSession 用户的一个 session，通过 sessHub.ListUserSessions() 获取
+type UserSession struct {
+	// StoreKey 用于区分 session，不要返回给客户端
+	StoreKey  string
+	CreatedAt time.Time
+	BoundAt   time.Time
+	UserAgent string
+	IP        string
+}
+
+// BindUser 将 session 绑定到 userID 并记录设备信息，一般在登录成功并 Regenerate() 之后调用
+// UserAgent 和 IP 从 CookieReadWriter HeaderReadWriter AuthorizationReadWriter 的请求中读取
+// 使用反向代理时 RemoteAddr 不是客户端 IP，需要使用 session.BindUserWithMeta()
+// 需要 Store 实现 sess.StoreUserIndexer
+func (s Session) BindUser(ctx context.Context, userID string) (err error) {
+	return s.BindUserWithMeta(ctx, userID, requestUserSessionMeta(s.rw))
+}
+
+// BindUserWithMeta 将 session 绑定到 userID 并记录 meta
+// 设置了 HubOption{}.MaxSessionsPerUser 时根据 HubOption{}.SessionLimitPolicy 踢出旧的 session 或返回 sess.ErrSessionLimitExceeded
+func (s Session) BindUserWithMeta(ctx context.Context, userID string, meta UserSessionMeta) (err error) {
+	if len(userID) == 0 {
+		return xerr.New("goclub/session: Session{}.BindUser(ctx, userID) userID can not be empty string")
+	}
+	indexer, ok := s.hub.store.(StoreUserIndexer)
+	if ok == false {
+		return xerr.New("goclub/session: Session{}.BindUser(ctx, userID) store must implement sess.StoreUserIndexer")
+	}
+	storeKey, err := s.backed(ctx)
+	if err != nil {
+		return
+	}
+	err = s.hub.checkSessionLimit(ctx, userID, storeKey)
+	if err != nil {
+		return
+	}
+	bound, err := indexer.BindUser(ctx, storeKey, userID, meta)
+	if err != nil {
+		return
+	}
+	if bound == false {
+		return xerr.New("goclub/session: Session{}.BindUser(ctx, userID) session does not exist or has expired")
+	}
+	err = s.hub.evictOldestSessions(ctx, userID, storeKey)
+	if err != nil {
+		return
+	}
+	s.rememberCache(map[string]string{
+		userIDField:    userID,
+		userAgentField: meta.UserAgent,
+		userIPField:    meta.IP,
+	})
+	return
+}
+
+// rememberCache 开启 HubOption{}.RequestCache 时将已经直接写入 store 的数据同步到缓存
+func (s Session) rememberCache(values map[string]string) {
+	if s.cached() == false {
+		return
+	}
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	cache := s.state.cache
+	for field, value := range values {
+		if cache.loaded {
+			cache.values[field] = value
+		}
+		delete(cache.dirty, field)
+		delete(cache.deleted, field)
+	}
+}
+
+// UserID 返回 session.BindUser() 绑定的 userID，未绑定时 has = false
+func (s Session) UserID(ctx context.Context) (userID string, has bool, err error) {
+	return s.Get(ctx, userIDField)
+}
+
+// ListUserSessions 返回用户所有未过期的 session，按绑定时间升序排列
+// 需要 Store 实现 sess.StoreUserIndexer
+func (hub Hub) ListUserSessions(ctx context.Context, userID string) (sessions []UserSession, err error) {
+	indexer, ok := hub.store.(StoreUserIndexer)
+	if ok == false {
+		return nil, xerr.New("goclub/session: Hub{}.ListUserSessions(ctx, userID) store must implement sess.StoreUserIndexer")
+	}
+	return indexer.UserSessions(ctx, userID)
+}
+
+// DestroyUserSessions 销毁用户所有的 session，except 中的 sessionID 会被保留
+// 例如 "退出其他设备": sessHub.DestroyUserSessions(ctx, userID, session.ID())
+func (hub Hub) DestroyUserSessions(ctx context.Context, userID string, except ...string) (err error) {
+	exceptStoreKeys := map[string]bool{}
+	for _, sessionID := range except {
+		storeKey, _, err := hub.option.decryptSessionID(sessionID)
+		if err != nil {
+			return err
+		}
+		exceptStoreKeys[storeKey] = true
+	}
+	sessions, err := hub.ListUserSessions(ctx, userID)
+	if err != nil {
+		return
+	}
+	for _, session := range sessions {
+		if exceptStoreKeys[session.StoreKey] {
+			continue
+		}
+		err = hub.store.Destroy(ctx, session.StoreKey)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// requestUserSessionMeta 从 ReadWriter 的请求中读取设备信息
+func requestUserSessionMeta(rw SessionHttpReadWriter) (meta UserSessionMeta) {
+	switch v := rw.(type) {
+	case CookieReadWriter:
+		if v.Request == nil {
+			return
+		}
+		meta.UserAgent = v.Request.UserAgent()
+		meta.IP = v.Request.RemoteAddr
+		if host, _, err := net.SplitHostPort(v.Request.RemoteAddr); err == nil {
+			meta.IP = host
+		}
+	case HeaderReadWriter:
+		meta.UserAgent = v.Header.Get("User-Agent")
+	case AuthorizationReadWriter:
+		meta.UserAgent = v.Header.Get("User-Agent")
+	case *ChainReadWriter:
+		if source, _, has := v.Source(); has {
+			return requestUserSessionMeta(source)
+		}
+		for _, readWriter := range v.readWriters {
+			meta = requestUserSessionMeta(readWriter)
+			if meta != (UserSessionMeta{}) {
+				return
+			}
+		}
+	}
+	return
+}
+
+// sortUserSessions 按绑定时间升序排列，绑定时间相同时按 StoreKey 排序保证顺序是确定的
+func sortUserSessions(sessions []UserSession) {
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].BoundAt.Equal(sessions[j].BoundAt) {
+			return sessions[i].StoreKey < sessions[j].StoreKey
+		}
+		return sessions[i].BoundAt.Before(sessions[j].BoundAt)
+	})
+}
@@ -0,0 +1,168 @@
+package sess
+
+import (
+	"context"
+	xerr "github.com/goclub/error"
+	"sync"
+	"time"
+)
+
+// ErrSessionEnded session 已被销毁或已过期
+var ErrSessionEnded = xerr.New("goclub/session: session ended")
+
+type SessionWatcherOption struct {
+	// 检查间隔，默认 10s
+	// 未开启 KeepAlive 时如果 session 剩余有效期小于 Interval 会在到期时立即检查
+	Interval time.Duration
+	// 开启后每次检查视为一次访问，按照 HubOption{}.RenewPolicy 续期(不超过 AbsoluteTTL)，用于连接活跃期间保持 session
+	// Interval 必须小于续期阈值，例如默认的 RenewAtFraction 为 SessionTTL 的一半，否则 session 可能在两次检查之间过期
+	// RenewNever 不会续期，session 仍然在到期时结束
+	KeepAlive bool
+	// 检查 store 出错时调用，出错后会在下一个 Interval 重试
+	OnError func(err error)
+}
+
+// SessionWatcher 在 WebSocket 等长连接中定期检查 session 是否存在，session 结束时取消 Context()
+// 通过 session.Watch(ctx, option) 创建
+type SessionWatcher struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+	err    error
+}
+
+// Watch 开始观察 session，返回的 watcher.Context() 在 session 结束、ctx 取消或 watcher.Stop() 时取消
+// 使用完毕后需要调用 watcher.Stop() 释放资源
+func (s Session) Watch(ctx context.Context, option SessionWatcherOption) (watcher *SessionWatcher, err error) {
+	if option.Interval == 0 {
+		option.Interval = time.Second * 10
+	}
+	if option.Interval < 0 {
+		return nil, xerr.New("goclub/session: SessionWatcherOption{}.Interval can not be negative")
+	}
+	if option.KeepAlive {
+		threshold := s.hub.option.SessionTTL
+		if policy, ok := s.hub.option.RenewPolicy.(thresholdRenewPolicy); ok {
+			_, threshold, _ = policy.renewThreshold(s.hub.option.SessionTTL)
+		}
+		if threshold > 0 && option.Interval >= threshold {
+			return nil, xerr.New("goclub/session: SessionWatcherOption{}.Interval must be less than renew threshold of HubOption{}.RenewPolicy when KeepAlive is true")
+		}
+	}
+	watchCtx, cancel := context.WithCancel(ctx)
+	watcher = &SessionWatcher{
+		ctx:    watchCtx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go watcher.run(s, option)
+	return watcher, nil
+}
+
+// Context 在 session 结束、Watch 的 ctx 取消或 Stop() 时取消
+func (w *SessionWatcher) Context() context.Context {
+	return w.ctx
+}
+
+// Done 等同于 watcher.Context().Done()
+func (w *SessionWatcher) Done() <-chan struct{} {
+	return w.ctx.Done()
+}
+
+// Err 返回停止观察的原因
+// session 结束时返回 sess.ErrSessionEnded，session 被踢出时返回 *sess.SessionEvictedError，Watch 的 ctx 取消时返回 ctx.Err()，调用 Stop() 时返回 context.Canceled，观察中返回 nil
+func (w *SessionWatcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Stop 停止观察并等待后台 goroutine 退出
+func (w *SessionWatcher) Stop() {
+	w.end(context.Canceled)
+	<-w.done
+}
+
+// end 只记录第一次结束的原因
+func (w *SessionWatcher) end(err error) {
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.mu.Unlock()
+	w.cancel()
+}
+func (w *SessionWatcher) run(s Session, option SessionWatcherOption) {
+	defer close(w.done)
+	// 立即检查一次，未开启 KeepAlive 时可以根据剩余有效期安排下一次检查
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			w.end(w.ctx.Err())
+			return
+		case <-timer.C:
+		}
+		next, endErr, err := s.watch(w.ctx, option)
+		if err != nil {
+			// 停止观察导致的错误不需要通知
+			if w.ctx.Err() != nil {
+				continue
+			}
+			if option.OnError != nil {
+				option.OnError(err)
+			}
+			next = option.Interval
+		}
+		if endErr != nil {
+			w.end(endErr)
+			return
+		}
+		timer.Reset(next)
+	}
+}
+
+// watch 检查一次 session，返回下一次检查的间隔，session 结束时 endErr 为结束的原因
+func (s Session) watch(ctx context.Context, option SessionWatcherOption) (next time.Duration, endErr error, err error) {
+	next = option.Interval
+	// 延迟创建模式下还未创建的 session 没有可以观察的数据
+	if s.unbacked() {
+		return
+	}
+	storeKey := s.storeKey()
+	var existed bool
+	var evictedReason EvictReason
+	if option.KeepAlive {
+		// 与获取 session 一致，按照 HubOption{}.RenewPolicy 续期，被踢出的 session 不会续期
+		existed, evictedReason, err = s.hub.touch(ctx, storeKey)
+	} else {
+		// 被踢出的 session 只保留了踢出原因，key 仍然存在
+		if s.hub.option.MaxSessionsPerUser > 0 {
+			evictedReason, _, err = s.hub.evictedReason(ctx, storeKey)
+			if err != nil {
+				return
+			}
+		}
+		existed, err = s.hub.store.StoreKeyExists(ctx, storeKey)
+	}
+	if err != nil {
+		return
+	}
+	if existed && evictedReason != "" {
+		return 0, xerr.WithStack(&SessionEvictedError{Reason: evictedReason}), nil
+	}
+	if existed == false {
+		return 0, ErrSessionEnded, nil
+	}
+	remainingTTL, err := s.hub.store.StoreKeyRemainingTTL(ctx, storeKey)
+	if err != nil {
+		return
+	}
+	// 在到期时立即检查，多等待 1ms 避免 store 的时间精度导致提前检查
+	if remainingTTL > 0 && remainingTTL < next {
+		next = remainingTTL + time.Millisecond
+	}
+	return next, nil, nil
+}